@@ -0,0 +1,228 @@
+package otame
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Weight of a title matched by its acronym, such as "SAO" for "Sword Art
+// Online". Acronyms are shared by unrelated titles far more often than
+// words are, so it is kept below the weight of a direct match.
+var AcronymMatchWeight = 0.9
+
+// Longest acronym indexed, longer ones are too unlikely to be searched.
+const maxAcronymLength = 8
+
+// Particles and articles left out of the shorter acronym variants,
+// so that "Shingeki no Kyojin" is found as both "SnK" and "SK".
+var acronymStopWords = map[string]bool{
+	"no": true, "wo": true, "ga": true, "ni": true, "wa": true, "to": true, "de": true,
+	"the": true, "a": true, "an": true, "of": true, "and": true, "in": true, "on": true,
+}
+
+// Splits a title into words at anything but letters and digits,
+// and at lower to upper case changes within words if camel is set.
+func acronymWords(title string, camel bool) (words []string) {
+	var word []rune
+
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+
+	for _, r := range title {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+
+		if n := len(word); n > 0 {
+			previous := word[n-1]
+
+			if camel && unicode.IsLower(previous) && unicode.IsUpper(r) || unicode.IsDigit(previous) != unicode.IsDigit(r) {
+				flush()
+			}
+		}
+
+		word = append(word, r)
+	}
+
+	flush()
+
+	return
+}
+
+// Initials of the words, with numbers kept whole.
+func acronymOf(words []string, skipStopWords bool) string {
+	var b strings.Builder
+
+	for _, word := range words {
+		lower := strings.ToLower(word)
+
+		if skipStopWords && acronymStopWords[lower] {
+			continue
+		}
+
+		if unicode.IsDigit([]rune(word)[0]) {
+			b.WriteString(word)
+		} else {
+			b.WriteRune([]rune(lower)[0])
+		}
+	}
+
+	return b.String()
+}
+
+// Returns the lower-case acronyms a Latin-script title may be searched by,
+// such as "sao" for "Sword Art Online: Alicization", or none for titles of
+// other scripts and titles of a single word. Acronyms are made of the words
+// of the title, with and without particles, split at camel case or not, and
+// of the part before a subtitle on their own.
+func TitleAcronyms(title string) (acronyms []string) {
+	for _, r := range title {
+		if unicode.IsLetter(r) && runeScript(r) != ScriptLatin {
+			return
+		}
+	}
+
+	parts := []string{title}
+
+	if main, _, ok := strings.Cut(title, ":"); ok {
+		parts = append(parts, main)
+	}
+
+	seen := make(map[string]bool)
+
+	for _, part := range parts {
+		for _, camel := range []bool{false, true} {
+			words := acronymWords(part, camel)
+
+			if len(words) < 2 {
+				continue
+			}
+
+			for _, skipStopWords := range []bool{false, true} {
+				acronym := acronymOf(words, skipStopWords)
+				length := len([]rune(acronym))
+
+				if length < 2 || length > maxAcronymLength || seen[acronym] {
+					continue
+				}
+
+				seen[acronym] = true
+				acronyms = append(acronyms, acronym)
+			}
+		}
+	}
+
+	return
+}
+
+// TitleAcronyms as a JSON array, for the title_acronyms function
+// which triggers read with json_each.
+func titleAcronymsJSON(title string) string {
+	acronyms := TitleAcronyms(title)
+
+	if acronyms == nil {
+		acronyms = []string{}
+	}
+
+	encoded, _ := json.Marshal(acronyms)
+
+	return string(encoded)
+}
+
+// Reports whether a query looks like an acronym: a single short word of
+// Latin letters and digits, starting with an upper case letter and with at
+// least two of them, such as "SAO", "SnK" or "AoT".
+func isAcronymQuery(query string) bool {
+	query = strings.TrimSpace(query)
+	runes := []rune(query)
+
+	if len(runes) < 2 || len(runes) > maxAcronymLength || !unicode.IsUpper(runes[0]) {
+		return false
+	}
+
+	upper := 0
+
+	for _, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) || unicode.IsLetter(r) && runeScript(r) != ScriptLatin {
+			return false
+		}
+
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+
+	return upper >= 2
+}
+
+// Spans of the initials of the title making up the acronym, with numbers
+// whole, if found in order, so that acronym matches highlight like others.
+func acronymSpans(title string, acronym string) (spans []MatchSpan) {
+	for _, camel := range []bool{true, false} {
+		spans = nil
+		remaining := acronym
+		offset := 0
+
+		for _, word := range acronymWords(title, camel) {
+			start := offset + strings.Index(title[offset:], word)
+			offset = start + len(word)
+			initial := string([]rune(word)[0])
+
+			if unicode.IsDigit([]rune(word)[0]) {
+				initial = word
+			}
+
+			if !strings.HasPrefix(remaining, strings.ToLower(initial)) {
+				continue
+			}
+
+			spans = append(spans, MatchSpan{start, start + len(initial)})
+			remaining = remaining[len(strings.ToLower(initial)):]
+
+			if remaining == "" {
+				return
+			}
+		}
+	}
+
+	return nil
+}
+
+// Branch of titleSearch.matchesSQL selecting the live titles whose acronym
+// equals the route's match, with the same columns as FTS branches. Arguments
+// are the weight, query, acronym and live ID range, then the languages of
+// the route, checked against the titles of table.
+func acronymMatchesSQL(route titleIndexRoute, table string) string {
+	column := "title_id"
+
+	if route.contentID != "" {
+		column = route.contentID
+	}
+
+	column = route.table + "." + column
+	join, languageFilter := route.languageFilterSQL(table, column)
+
+	return fmt.Sprintf(`
+		SELECT
+			%[2]s AS docid,
+			1 AS rank,
+			'' AS offsets,
+			%[1]s.acronym AS text,
+			'acronym' AS column,
+			FALSE AS normalized,
+			? AS weight,
+			? AS query
+		FROM %[1]s
+		%[3]s
+		WHERE %[1]s.acronym = ?
+		AND %[2]s BETWEEN ? AND ?
+		%[4]s
+	`, route.table, column, join, languageFilter)
+}
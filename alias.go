@@ -0,0 +1,360 @@
+package otame
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Multiplier applied to the score of titles matched through a user alias,
+// in place of the language weights of title indexes.
+var UserAliasBoost = 1.5
+
+// A nickname for an anime or visual novel, such as "SnK" or "Oregairu",
+// which appears in none of the datasets.
+type UserAlias struct {
+	Alias string `json:"alias"`
+	// ProviderAniDB for an aid, ProviderVNDB for a vnid, or any other
+	// anime offline database provider, mapped to an aid when searching.
+	Provider Provider `json:"provider"`
+	ID       string   `json:"id"`
+}
+
+// Short provider names accepted in alias files.
+var userAliasProviderNames = map[string]Provider{
+	"anidb": ProviderAniDB,
+	"vndb":  ProviderVNDB,
+	"mal":   ProviderMyAnimeList,
+}
+
+func parseUserAliasProvider(name string) Provider {
+	if provider, ok := userAliasProviderNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return provider
+	}
+
+	return NormalizeProviderName(strings.TrimSpace(name))
+}
+
+func (a UserAlias) validate() error {
+	if normalizeTitle(a.Alias) == "" {
+		return fmt.Errorf("alias %q has no words", a.Alias)
+	}
+
+	if a.Provider == "" || a.ID == "" {
+		return fmt.Errorf("alias %q has no target", a.Alias)
+	}
+
+	return nil
+}
+
+// Decodes aliases from tab separated lines of alias, provider and ID, such as
+// "SnK	anidb	9541". Providers are given by hostname, or as anidb, vndb or
+// mal. Blank lines and lines starting with # are skipped.
+func NewUserAliasDecoder(r io.Reader) *genericLineDecoder[UserAlias] {
+	return &genericLineDecoder[UserAlias]{
+		scanner:       bufio.NewScanner(r),
+		commentChar:   "#",
+		separatorChar: "\t",
+		nCols:         3,
+		unmarshal: func(line []string) (alias UserAlias, err error) {
+			alias.Alias = strings.TrimSpace(line[0])
+			alias.Provider = parseUserAliasProvider(line[1])
+			alias.ID = strings.TrimSpace(line[2])
+			err = alias.validate()
+
+			return
+		},
+	}
+}
+
+// Decodes a JSON array of aliases, see UserAlias.
+func DecodeUserAliasesJSON(r io.Reader) (aliases []UserAlias, err error) {
+	if err = json.NewDecoder(r).Decode(&aliases); err != nil {
+		return
+	}
+
+	for i := range aliases {
+		aliases[i].Provider = parseUserAliasProvider(string(aliases[i].Provider))
+
+		if err = aliases[i].validate(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Adds the aliases of a JSON file, if its name ends in .json,
+// or else of a tab separated file, see NewUserAliasDecoder.
+func LoadUserAliasesFile(fileName string) (err error) {
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		var aliases []UserAlias
+
+		if aliases, err = DecodeUserAliasesJSON(file); err != nil {
+			return
+		}
+
+		return AddUserAliases(aliases)
+	}
+
+	return AddUserAliasesFromIterator(NewUserAliasDecoder(file))
+}
+
+func CreateUserAliasTables() (err error) {
+	_, err = db.Exec(`
+		-- not part of any dataset, so kept across updates
+		CREATE TABLE IF NOT EXISTS user_aliases (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alias TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			UNIQUE(alias, provider, target_id)
+		);
+
+		CREATE VIRTUAL TABLE IF NOT EXISTS user_aliases_fts_idx USING fts4(
+			alias,
+			content='user_aliases',
+			tokenize=icu root
+		);
+
+		CREATE VIRTUAL TABLE IF NOT EXISTS user_aliases_fts_vocab USING fts4aux(user_aliases_fts_idx);
+
+		CREATE TRIGGER IF NOT EXISTS user_aliases_after_insert AFTER INSERT ON user_aliases
+		BEGIN
+			INSERT INTO user_aliases_fts_idx(docid, alias) VALUES (new.id, new.alias);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS user_aliases_before_delete BEFORE DELETE ON user_aliases
+		BEGIN
+			DELETE FROM user_aliases_fts_idx WHERE docid = old.id;
+		END;
+
+		-- aid or vnid of every alias, with aliases of other providers
+		-- mapped to aids through the anime offline database
+		CREATE VIEW IF NOT EXISTS user_alias_targets AS
+			SELECT id AS alias_id, 'anidb_titles' AS content_table, target_id
+			FROM user_aliases
+			WHERE provider = 'anidb.net'
+			UNION ALL
+			SELECT id, 'vndb_titles', target_id
+			FROM user_aliases
+			WHERE provider = 'vndb.org'
+			UNION ALL
+			SELECT DISTINCT user_aliases.id, 'anidb_titles', dst.source_id
+			FROM user_aliases
+			JOIN anime_offline_database_sources AS src
+			ON src.source_name = user_aliases.provider
+			AND src.source_id = user_aliases.target_id
+			JOIN anime_offline_database_sources AS dst
+			ON dst.anime_offline_database_id = src.anime_offline_database_id
+			AND dst.source_name = 'anidb.net'
+			WHERE user_aliases.provider NOT IN ('anidb.net', 'vndb.org');
+	`)
+
+	return
+}
+
+func AddUserAlias(alias UserAlias) error {
+	return AddUserAliases([]UserAlias{alias})
+}
+
+// Adds the aliases in a single transaction, ignoring those already added.
+func AddUserAliases(aliases []UserAlias) (err error) {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return
+	}
+
+	defer tx.Rollback()
+
+	for _, alias := range aliases {
+		if err = CreateUserAliasWithTx(tx, alias); err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+
+	return
+}
+
+func AddUserAliasesFromIterator[
+	T RowIterator[UserAlias],
+](iter T) (err error) {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return
+	}
+
+	defer tx.Rollback()
+
+	for {
+		var alias UserAlias
+		alias, err = iter.Next()
+
+		if err == ErrEOF {
+			break
+		}
+
+		if err != nil {
+			return
+		}
+
+		if err = CreateUserAliasWithTx(tx, alias); err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+
+	return
+}
+
+func CreateUserAliasWithTx(tx *sql.Tx, alias UserAlias) (err error) {
+	if err = alias.validate(); err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO user_aliases (
+			alias,
+			provider,
+			target_id
+		) VALUES (?, ?, ?)
+	`, strings.TrimSpace(alias.Alias), string(alias.Provider), alias.ID)
+
+	return
+}
+
+// Deletes an alias of the target, if it exists.
+func DeleteUserAlias(alias UserAlias) (err error) {
+	_, err = db.Exec(`
+		DELETE FROM user_aliases
+		WHERE alias = ?
+		AND provider = ?
+		AND target_id = ?
+	`, strings.TrimSpace(alias.Alias), string(alias.Provider), alias.ID)
+
+	return
+}
+
+func DeleteAllUserAliases() (err error) {
+	_, err = db.Exec("DELETE FROM user_aliases")
+	return
+}
+
+// Returns every alias, in the order they were added.
+func GetUserAliases() (aliases []UserAlias, err error) {
+	rows, err := db.Query(`
+		SELECT alias, provider, target_id
+		FROM user_aliases
+		ORDER BY id
+	`)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias UserAlias
+		var provider string
+
+		if err = rows.Scan(&alias.Alias, &provider, &alias.ID); err != nil {
+			return
+		}
+
+		alias.Provider = Provider(provider)
+		aliases = append(aliases, alias)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// Column holding the aid or vnid of each content table, and the order
+// in which the titles of an anime or visual novel are considered to
+// find the main one, which aliases match in place of the alias itself.
+var userAliasContentTables = map[string]struct {
+	idColumn       string
+	mainTitleOrder string
+}{
+	"anidb_titles": {"aid", "type = 'primary' DESC, id"},
+	"vndb_titles": {"vnid", `
+		language = (SELECT original_language FROM vndb_visual_novels WHERE vnid = vndb_titles.vnid) DESC,
+		official DESC,
+		id
+	`},
+}
+
+// Index of the aliases of anime or visual novels of the content table.
+func userAliasIndex(table string) titleIndex {
+	return titleIndex{table: "user_aliases_fts_idx", indexedColumn: "alias", aliasTable: table}
+}
+
+// Leaves out the alias indexes if the tables of aliases, or the anime
+// offline database sources their targets are mapped through, have not been
+// created, see CreateUserAliasTables and CreateAnimeOfflineDatabaseTables.
+func withoutMissingAliasIndexes(indexes []titleIndex) (available []titleIndex, err error) {
+	missing, err := missingTables("user_aliases", "user_aliases_fts_idx", "anime_offline_database_sources")
+
+	if err != nil || len(missing) == 0 {
+		return indexes, err
+	}
+
+	for _, index := range indexes {
+		if index.aliasTable == "" && index.table != "user_aliases_fts_idx" {
+			available = append(available, index)
+		}
+	}
+
+	return
+}
+
+// Branch of titleSearch.matchesSQL matching aliases through the route,
+// selecting the live main title of their anime or visual novel as docid.
+// Arguments are the weight, query, live ID range and match expression.
+func userAliasMatchesSQL(route titleIndexRoute) string {
+	content := userAliasContentTables[route.aliasTable]
+
+	return fmt.Sprintf(`
+		SELECT
+			%[1]s.id AS docid,
+			rank(matchinfo(user_aliases_fts_idx)) AS rank,
+			offsets(user_aliases_fts_idx) AS offsets,
+			user_aliases_fts_idx.alias AS text,
+			'alias' AS column,
+			FALSE AS normalized,
+			? AS weight,
+			? AS query
+		FROM user_aliases_fts_idx
+		JOIN user_alias_targets AS targets
+		ON targets.alias_id = user_aliases_fts_idx.docid
+		AND targets.content_table = '%[1]s'
+		JOIN %[1]s ON %[1]s.id = (
+			SELECT id FROM %[1]s
+			WHERE %[2]s = targets.target_id
+			AND id BETWEEN ? AND ?
+			ORDER BY %[3]s
+			LIMIT 1
+		)
+		WHERE user_aliases_fts_idx MATCH ?
+	`, route.aliasTable, content.idColumn, content.mainTitleOrder)
+}
@@ -6,7 +6,26 @@ import (
 	"io"
 )
 
+const (
+	AnimeOfflineDatabaseTypeTV      = "TV"
+	AnimeOfflineDatabaseTypeMovie   = "MOVIE"
+	AnimeOfflineDatabaseTypeOVA     = "OVA"
+	AnimeOfflineDatabaseTypeONA     = "ONA"
+	AnimeOfflineDatabaseTypeSpecial = "SPECIAL"
+	AnimeOfflineDatabaseTypeUnknown = "UNKNOWN"
+)
+
+const (
+	AnimeOfflineDatabaseStatusFinished = "FINISHED"
+	AnimeOfflineDatabaseStatusOngoing  = "ONGOING"
+	AnimeOfflineDatabaseStatusUpcoming = "UPCOMING"
+	AnimeOfflineDatabaseStatusUnknown  = "UNKNOWN"
+)
+
 type AnimeOfflineDatabaseEntry struct {
+	// Row ID in the anime_offline_database table. Not part of the
+	// source data, and only set on entries read from the database.
+	ID          string   `json:"-"`
 	Sources     []string `json:"sources"`
 	Title       string   `json:"title"`
 	Type        string   `json:"type"`
@@ -21,6 +40,15 @@ type AnimeOfflineDatabaseEntry struct {
 	Synonyms  []string `json:"synonyms"`
 	Relations []string `json:"relations"`
 	Tags      []string `json:"tags"`
+	// Missing from older releases of the database.
+	Score *AnimeOfflineDatabaseScore `json:"score"`
+}
+
+// Score of an entry averaged over its sources, from 1 to 10.
+type AnimeOfflineDatabaseScore struct {
+	ArithmeticGeometricMean float64 `json:"arithmeticGeometricMean"`
+	ArithmeticMean          float64 `json:"arithmeticMean"`
+	Median                  float64 `json:"median"`
 }
 
 type AnimeOfflineDatabaseDecoder struct {
@@ -0,0 +1,328 @@
+package otame
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	AnimeOfflineDatabaseSortByID       = "id"
+	AnimeOfflineDatabaseSortByTitle    = "title"
+	AnimeOfflineDatabaseSortByYear     = "year"
+	AnimeOfflineDatabaseSortByEpisodes = "episodes"
+)
+
+var aodbSortColumns = map[string]string{
+	AnimeOfflineDatabaseSortByID:       "anime_offline_database.id",
+	AnimeOfflineDatabaseSortByTitle:    "anime_offline_database.title COLLATE NOCASE",
+	AnimeOfflineDatabaseSortByYear:     "anime_offline_database.season_year",
+	AnimeOfflineDatabaseSortByEpisodes: "anime_offline_database.episodes",
+}
+
+// Zero values are ignored, so the zero filter matches every live entry.
+type AnimeOfflineDatabaseFilter struct {
+	// Substring matched against the title and synonyms, or acronym
+	// of either if it looks like one, such as "SAO".
+	Title string
+
+	// Entry must match one of the listed values.
+	Types    []string
+	Statuses []string
+	Seasons  []string
+
+	// Inclusive bounds. Entries without a year never match a year bound.
+	MinYear     *int
+	MaxYear     *int
+	MinEpisodes *int
+	MaxEpisodes *int
+
+	// Entry must have at least one of TagsAny, every tag of TagsAll
+	// and none of TagsNone.
+	TagsAny  []string
+	TagsAll  []string
+	TagsNone []string
+
+	// One of the AnimeOfflineDatabaseSortBy* constants, defaults to ID.
+	SortBy     string
+	Descending bool
+
+	// Limit <= 0 means no limit.
+	Limit  int
+	Offset int
+}
+
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func appendStringArgs(args []any, values []string) []any {
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	return args
+}
+
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (f AnimeOfflineDatabaseFilter) whereClause() (clause string, args []any, err error) {
+	firstID, lastID, err := getLiveRangeOfTable("anime_offline_database")
+
+	if err != nil {
+		return
+	}
+
+	conditions := []string{"anime_offline_database.id BETWEEN ? AND ?"}
+	args = append(args, firstID, lastID)
+
+	if f.Title != "" {
+		pattern := "%" + escapeLikePattern(f.Title) + "%"
+		conditions = append(conditions, `(
+			anime_offline_database.title LIKE ? ESCAPE '\'
+			OR anime_offline_database.id IN (
+				SELECT anime_offline_database_id
+				FROM anime_offline_database_synonyms
+				WHERE synonym LIKE ? ESCAPE '\'
+			)
+		)`)
+		args = append(args, pattern, pattern)
+
+		if isAcronymQuery(f.Title) {
+			conditions[len(conditions)-1] = fmt.Sprintf(`(%s
+				OR anime_offline_database.id IN (
+					SELECT anime_offline_database_id
+					FROM anime_offline_database_acronyms
+					WHERE acronym = ?
+				)
+			)`, conditions[len(conditions)-1])
+			args = append(args, strings.ToLower(strings.TrimSpace(f.Title)))
+		}
+	}
+
+	inConditions := []struct {
+		column string
+		values []string
+	}{
+		{"anime_offline_database.type", f.Types},
+		{"anime_offline_database.status", f.Statuses},
+		{"anime_offline_database.season", f.Seasons},
+	}
+
+	for _, c := range inConditions {
+		if len(c.values) == 0 {
+			continue
+		}
+
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", c.column, sqlPlaceholders(len(c.values))))
+		args = appendStringArgs(args, c.values)
+	}
+
+	boundConditions := []struct {
+		condition string
+		value     *int
+	}{
+		{"anime_offline_database.season_year >= ?", f.MinYear},
+		{"anime_offline_database.season_year <= ?", f.MaxYear},
+		{"anime_offline_database.episodes >= ?", f.MinEpisodes},
+		{"anime_offline_database.episodes <= ?", f.MaxEpisodes},
+	}
+
+	for _, c := range boundConditions {
+		if c.value == nil {
+			continue
+		}
+
+		conditions = append(conditions, c.condition)
+		args = append(args, *c.value)
+	}
+
+	if len(f.TagsAny) > 0 {
+		conditions = append(conditions, fmt.Sprintf(`anime_offline_database.id IN (
+			SELECT anime_offline_database_id
+			FROM anime_offline_database_tags
+			WHERE tag IN (%s)
+		)`, sqlPlaceholders(len(f.TagsAny))))
+		args = appendStringArgs(args, f.TagsAny)
+	}
+
+	if len(f.TagsAll) > 0 {
+		conditions = append(conditions, fmt.Sprintf(`(
+			SELECT COUNT(DISTINCT tag)
+			FROM anime_offline_database_tags
+			WHERE anime_offline_database_id = anime_offline_database.id
+			AND tag IN (%s)
+		) = ?`, sqlPlaceholders(len(f.TagsAll))))
+		args = appendStringArgs(args, f.TagsAll)
+		args = append(args, len(uniqueStrings(f.TagsAll)))
+	}
+
+	if len(f.TagsNone) > 0 {
+		conditions = append(conditions, fmt.Sprintf(`anime_offline_database.id NOT IN (
+			SELECT anime_offline_database_id
+			FROM anime_offline_database_tags
+			WHERE tag IN (%s)
+		)`, sqlPlaceholders(len(f.TagsNone))))
+		args = appendStringArgs(args, f.TagsNone)
+	}
+
+	clause = strings.Join(conditions, "\n\t\t\tAND ")
+
+	return
+}
+
+func uniqueStrings(values []string) (unique []string) {
+	seen := make(map[string]bool, len(values))
+
+	for _, value := range values {
+		if seen[value] {
+			continue
+		}
+
+		seen[value] = true
+		unique = append(unique, value)
+	}
+
+	return
+}
+
+func (f AnimeOfflineDatabaseFilter) orderByClause() (clause string, err error) {
+	sortBy := f.SortBy
+
+	if sortBy == "" {
+		sortBy = AnimeOfflineDatabaseSortByID
+	}
+
+	column, ok := aodbSortColumns[sortBy]
+
+	if !ok {
+		err = fmt.Errorf("invalid sort column: %s", f.SortBy)
+		return
+	}
+
+	direction := "ASC"
+
+	if f.Descending {
+		direction = "DESC"
+	}
+
+	clause = fmt.Sprintf("%s %s, anime_offline_database.id %s", column, direction, direction)
+
+	// entries without a year always go last
+	if sortBy == AnimeOfflineDatabaseSortByYear {
+		clause = "anime_offline_database.season_year IS NULL, " + clause
+	}
+
+	return
+}
+
+// Returns live entries matching the filter, including their sources,
+// synonyms, relations and tags.
+func FilterAnimeOfflineDatabaseEntries(filter AnimeOfflineDatabaseFilter) (entries []AnimeOfflineDatabaseEntry, err error) {
+	where, args, err := filter.whereClause()
+
+	if err != nil {
+		return
+	}
+
+	orderBy, err := filter.orderByClause()
+
+	if err != nil {
+		return
+	}
+
+	limit := filter.Limit
+
+	if limit <= 0 {
+		limit = -1
+	}
+
+	querySQL := fmt.Sprintf(`
+		SELECT
+			anime_offline_database.id,
+			anime_offline_database.title,
+			anime_offline_database.type,
+			anime_offline_database.episodes,
+			anime_offline_database.status,
+			anime_offline_database.season,
+			anime_offline_database.season_year,
+			anime_offline_database.picture,
+			anime_offline_database.thumbnail
+		FROM
+			anime_offline_database
+		WHERE
+			%s
+		ORDER BY %s
+		LIMIT ? OFFSET ?
+	`, where, orderBy)
+
+	args = append(args, limit, filter.Offset)
+	entries, err = queryAnimeOfflineDatabaseEntries(querySQL, args...)
+
+	return
+}
+
+// Returns the number of live entries matching the filter,
+// ignoring its sorting and pagination fields.
+func CountAnimeOfflineDatabaseEntries(filter AnimeOfflineDatabaseFilter) (count int, err error) {
+	where, args, err := filter.whereClause()
+
+	if err != nil {
+		return
+	}
+
+	querySQL := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM anime_offline_database
+		WHERE
+			%s
+	`, where)
+
+	err = db.QueryRow(querySQL, args...).Scan(&count)
+
+	return
+}
+
+// Runs a query selecting the anime_offline_database columns in table order
+// and loads the details of every resulting entry.
+func queryAnimeOfflineDatabaseEntries(querySQL string, args ...any) (entries []AnimeOfflineDatabaseEntry, err error) {
+	rows, err := db.Query(querySQL, args...)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AnimeOfflineDatabaseEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.Title,
+			&entry.Type,
+			&entry.Episodes,
+			&entry.Status,
+			&entry.AnimeSeason.Season,
+			&entry.AnimeSeason.Year,
+			&entry.Picture,
+			&entry.Thumbnail,
+		)
+
+		if err != nil {
+			return
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	rows.Close()
+
+	err = appendDetailsToAnimeOfflineDatabaseEntries(entries)
+
+	return
+}
@@ -0,0 +1,228 @@
+package otame
+
+import (
+	"fmt"
+)
+
+// Multiplier applied to the score of entries matched by a synonym
+// rather than their title.
+var AnimeOfflineDatabaseSynonymWeight = 0.95
+
+var (
+	aodbTitleIndex   = titleIndex{table: "anime_offline_database_fts_idx"}
+	aodbSynonymIndex = titleIndex{
+		table:         "anime_offline_database_synonyms_fts_idx",
+		indexedColumn: "synonym",
+		fixedWeight:   &AnimeOfflineDatabaseSynonymWeight,
+		contentID:     "(SELECT anime_offline_database_id FROM anime_offline_database_synonyms WHERE anime_offline_database_synonyms.id = docid)",
+	}
+	aodbAcronymIndex = titleIndex{
+		table:     "anime_offline_database_acronyms",
+		scripts:   []string{ScriptLatin},
+		acronym:   true,
+		contentID: "anime_offline_database_id",
+	}
+)
+
+var aodbIndexes = []titleIndex{
+	aodbTitleIndex,
+	aodbSynonymIndex,
+	aodbAcronymIndex,
+}
+
+type AnimeOfflineDatabaseSearchResult struct {
+	AnimeOfflineDatabaseEntry
+	Score float64
+	// Title or synonym matched by the query, see Highlight.
+	Matched string
+	// Parts of Matched matched by the query.
+	Spans []MatchSpan
+	// Set when the query matched a synonym rather than the title.
+	MatchedSynonym bool
+	// Same as AniDBSearchResult.Acronym, made from Matched.
+	Acronym string
+}
+
+func (r *AnimeOfflineDatabaseSearchResult) setMatch(m titleMatch) {
+	switch m.column {
+	case "synonym":
+		r.Matched = m.text
+		r.MatchedSynonym = true
+		r.Spans = m.spans(r.Matched)
+	case "acronym":
+		r.Acronym = m.text
+		r.Matched = r.Title
+		r.Spans = acronymSpans(r.Matched, r.Acronym)
+
+		// the acronym may have been made from a synonym
+		for _, synonym := range r.Synonyms {
+			if r.Spans != nil {
+				break
+			}
+
+			r.Matched = synonym
+			r.MatchedSynonym = true
+			r.Spans = acronymSpans(r.Matched, r.Acronym)
+		}
+	default:
+		r.Matched = r.Title
+		r.Spans = m.spans(r.Matched)
+	}
+}
+
+// Returns the matched title or synonym with every
+// matched part wrapped in open and close.
+func (r AnimeOfflineDatabaseSearchResult) Highlight(open string, close string) string {
+	return highlightSpans(r.Matched, r.Spans, open, close)
+}
+
+type AnimeOfflineDatabaseSearchPage struct {
+	Results    []AnimeOfflineDatabaseSearchResult
+	Total      int
+	NextCursor string
+}
+
+// Searches the titles and synonyms of the live anime offline database
+// entries, and their acronyms for queries such as "SAO", returning each
+// entry once with its best match. Languages of the options are ignored,
+// as entries have none.
+func SearchAnimeOfflineDatabase(query string, opts SearchOptions) (results []AnimeOfflineDatabaseSearchResult, err error) {
+	s, err := newAnimeOfflineDatabaseSearch(query, opts)
+
+	if err != nil {
+		return
+	}
+
+	return searchAnimeOfflineDatabase(s, AnimeOfflineDatabaseFilter{})
+}
+
+// Same as SearchAnimeOfflineDatabase, along with the total
+// number of matching entries and the cursor of the next page.
+func SearchAnimeOfflineDatabasePage(query string, opts SearchOptions) (page AnimeOfflineDatabaseSearchPage, err error) {
+	s, err := newAnimeOfflineDatabaseSearch(query, opts)
+
+	if err != nil {
+		return
+	}
+
+	if page.Results, err = searchAnimeOfflineDatabase(s, AnimeOfflineDatabaseFilter{}); err != nil {
+		return
+	}
+
+	if page.Total, err = s.count("id"); err != nil {
+		return
+	}
+
+	page.NextCursor = nextSearchCursor(s.offset, len(page.Results), page.Total, s.cursorKey)
+
+	return
+}
+
+func newAnimeOfflineDatabaseSearch(query string, opts SearchOptions) (s titleSearch, err error) {
+	opts.Languages = nil
+	return newTitleSearch("anime_offline_database", query, aodbIndexes, true, opts)
+}
+
+// Ranks the entries of the matches by their best matching title or synonym,
+// keeping those matching the filter, whose title, sorting and paging are ignored.
+func searchAnimeOfflineDatabase(s titleSearch, filter AnimeOfflineDatabaseFilter) (results []AnimeOfflineDatabaseSearchResult, err error) {
+	filter.Title = ""
+	whereClause, whereArgs, err := filter.whereClause()
+
+	if err != nil {
+		return
+	}
+
+	// bare columns of an aggregate query with a single MAX
+	// are taken from the row holding the maximum
+	querySQL := fmt.Sprintf(`
+		SELECT
+			anime_offline_database.id,
+			anime_offline_database.title,
+			anime_offline_database.type,
+			anime_offline_database.episodes,
+			anime_offline_database.status,
+			anime_offline_database.season,
+			anime_offline_database.season_year,
+			anime_offline_database.picture,
+			anime_offline_database.thumbnail,
+			MAX(%s) AS score,
+			matches.offsets,
+			matches.text,
+			matches.column,
+			matches.normalized,
+			matches.query
+		FROM (%s) AS matches
+		JOIN anime_offline_database ON anime_offline_database.id = matches.docid
+		WHERE %s
+		GROUP BY anime_offline_database.id
+		ORDER BY score DESC, anime_offline_database.id
+		LIMIT ? OFFSET ?
+	`, s.scoreSQL(), s.matchesSQL(), whereClause)
+
+	s.popularityKey = registerPopularityFunc(s.popularityFunc)
+	defer releasePopularityFunc(s.popularityKey)
+
+	args := append(s.scoreArgs(), s.matchesArgs()...)
+	args = append(args, whereArgs...)
+	rows, err := db.Query(querySQL, append(args, s.limit, s.offset)...)
+
+	if err != nil {
+		err = wrapMatchError(s.query, err)
+		return
+	}
+
+	defer rows.Close()
+
+	var matches []titleMatch
+
+	var entries []AnimeOfflineDatabaseEntry
+
+	for rows.Next() {
+		var entry AnimeOfflineDatabaseEntry
+		var result AnimeOfflineDatabaseSearchResult
+		var match titleMatch
+		err = rows.Scan(
+			&entry.ID,
+			&entry.Title,
+			&entry.Type,
+			&entry.Episodes,
+			&entry.Status,
+			&entry.AnimeSeason.Season,
+			&entry.AnimeSeason.Year,
+			&entry.Picture,
+			&entry.Thumbnail,
+			&result.Score,
+			&match.offsets,
+			&match.text,
+			&match.column,
+			&match.normalized,
+			&match.query,
+		)
+
+		if err != nil {
+			return
+		}
+
+		entries = append(entries, entry)
+		results = append(results, result)
+		matches = append(matches, match)
+	}
+
+	if err = wrapMatchError(s.query, rows.Err()); err != nil {
+		return
+	}
+
+	rows.Close()
+
+	if err = appendDetailsToAnimeOfflineDatabaseEntries(entries); err != nil {
+		return
+	}
+
+	for i := range results {
+		results[i].AnimeOfflineDatabaseEntry = entries[i]
+		results[i].setMatch(matches[i])
+	}
+
+	return
+}
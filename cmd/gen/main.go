@@ -16,10 +16,11 @@ import (
  */
 
 var (
-	aodbPath   = flag.String("aodb", "./data/anime-offline-database-minified.json", "Path to anime-offline-database.json")
-	anidbPath  = flag.String("anidb", "./data/anidb-titles.dat", "Path to anidb-titles.dat")
-	vndbPath   = flag.String("vndb", "./data/vndb-db-latest", "Path to vndb-db-latest (directory)")
-	outputPath = flag.String("o", "./otame.sqlite3", "Path to output sqlite3 database")
+	aodbPath    = flag.String("aodb", "./data/anime-offline-database-minified.json", "Path to anime-offline-database.json")
+	anidbPath   = flag.String("anidb", "./data/anidb-titles.dat", "Path to anidb-titles.dat")
+	vndbPath    = flag.String("vndb", "./data/vndb-db-latest", "Path to vndb-db-latest (directory)")
+	outputPath  = flag.String("o", "./otame.sqlite3", "Path to output sqlite3 database")
+	aliasesPath = flag.String("aliases", "", "Path to a TSV or JSON file of user aliases to add")
 )
 
 func main() {
@@ -82,6 +83,36 @@ func main() {
 		panic(err)
 	}
 
+	vnReleasesFilePath := path.Join(*vndbPath, "db", "releases_vn")
+	vnReleasesFile, err := os.Open(vnReleasesFilePath)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer vnReleasesFile.Close()
+
+	releasesDecoder := otame.NewVNDBReleaseVisualNovelEntryDecoder(vnReleasesFile)
+
+	if err = otame.ReplaceVNDBReleaseVisualNovelEntriesFromIterator(releasesDecoder); err != nil {
+		panic(err)
+	}
+
+	vnCharactersFilePath := path.Join(*vndbPath, "db", "chars_vns")
+	vnCharactersFile, err := os.Open(vnCharactersFilePath)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer vnCharactersFile.Close()
+
+	charactersDecoder := otame.NewVNDBCharacterVisualNovelEntryDecoder(vnCharactersFile)
+
+	if err = otame.ReplaceVNDBCharacterVisualNovelEntriesFromIterator(charactersDecoder); err != nil {
+		panic(err)
+	}
+
 	aodbFile, err := os.Open(*aodbPath)
 
 	if err != nil {
@@ -117,4 +148,14 @@ func main() {
 	if err = otame.ReplaceAniDBEntriesFromIterator(anidbDecoder); err != nil {
 		panic(err)
 	}
+
+	if err = otame.CreateUserAliasTables(); err != nil {
+		panic(err)
+	}
+
+	if *aliasesPath != "" {
+		if err = otame.LoadUserAliasesFile(*aliasesPath); err != nil {
+			panic(err)
+		}
+	}
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/xoltia/otame"
+)
+
+/* Resolves free-text titles read from stdin to AniDB aids or VNDB vnids.
+ * Input is TSV (or CSV with -format csv) with the title in the column
+ * given by -column. Every input row is written back to stdout with the
+ * source, id, matched title, confidence and ambiguous columns appended.
+ */
+
+var (
+	dbPath  = flag.String("db", "./otame.sqlite3", "Path to otame sqlite3 database")
+	format  = flag.String("format", "tsv", "Input and output format, tsv or csv")
+	column  = flag.Int("column", 0, "Index of the column holding the title")
+	header  = flag.Bool("header", false, "Whether the first row is a header")
+	sources = flag.String("sources", "anidb,vndb", "Comma separated sources to match against")
+)
+
+func main() {
+	flag.Parse()
+
+	err := otame.OpenDB(*dbPath)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer otame.CloseDB()
+
+	if *column < 0 {
+		panic("column must not be negative")
+	}
+
+	reader := csv.NewReader(os.Stdin)
+	reader.FieldsPerRecord = -1
+	writer := csv.NewWriter(os.Stdout)
+
+	switch *format {
+	case "tsv":
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+		writer.Comma = '\t'
+	case "csv":
+	default:
+		panic("unknown format: " + *format)
+	}
+
+	defer writer.Flush()
+
+	opts := otame.ResolveOptions{
+		Sources: strings.Split(*sources, ","),
+	}
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			panic(err)
+		}
+
+		if first && *header {
+			record = append(record, "source", "id", "matched_title", "confidence", "ambiguous")
+
+			if err = writer.Write(record); err != nil {
+				panic(err)
+			}
+
+			continue
+		}
+
+		if *column >= len(record) {
+			line, _ := reader.FieldPos(0)
+			panic(fmt.Errorf("line %d: no column %d in a record of %d columns", line, *column, len(record)))
+		}
+
+		title := record[*column]
+
+		resolution, err := otame.ResolveTitle(title, opts)
+
+		if err != nil {
+			panic(err)
+		}
+
+		if resolution.Found {
+			record = append(
+				record,
+				resolution.Source,
+				resolution.ID,
+				resolution.Title,
+				strconv.FormatFloat(resolution.Confidence, 'f', 3, 64),
+				strconv.FormatBool(resolution.Ambiguous),
+			)
+		} else {
+			record = append(record, "", "", "", "0", "false")
+		}
+
+		if err = writer.Write(record); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -14,7 +14,8 @@ import (
  */
 
 var (
-	outputPath = flag.String("o", "./otame.sqlite3", "Path to output sqlite3 database")
+	outputPath  = flag.String("o", "./otame.sqlite3", "Path to output sqlite3 database")
+	aliasesPath = flag.String("aliases", "", "Path to a TSV or JSON file of user aliases to add")
 )
 
 func main() {
@@ -90,6 +91,38 @@ func main() {
 		panic(err)
 	}
 
+	vnReleasesFile, err := vndbFS.Open("db/releases_vn")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer vnReleasesFile.Close()
+
+	fmt.Println("Replacing VNDB releases...")
+
+	releasesDecoder := otame.NewVNDBReleaseVisualNovelEntryDecoder(vnReleasesFile)
+
+	if err = otame.ReplaceVNDBReleaseVisualNovelEntriesFromIterator(releasesDecoder); err != nil {
+		panic(err)
+	}
+
+	vnCharactersFile, err := vndbFS.Open("db/chars_vns")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer vnCharactersFile.Close()
+
+	fmt.Println("Replacing VNDB characters...")
+
+	charactersDecoder := otame.NewVNDBCharacterVisualNovelEntryDecoder(vnCharactersFile)
+
+	if err = otame.ReplaceVNDBCharacterVisualNovelEntriesFromIterator(charactersDecoder); err != nil {
+		panic(err)
+	}
+
 	aodbFile, err := otame.DownloadAODB(context.Background())
 
 	fmt.Println("Downloading Anime Offline Database...")
@@ -112,6 +145,16 @@ func main() {
 		panic(err)
 	}
 
+	unrecognized, err := otame.GetUnrecognizedAnimeOfflineDatabaseSources()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if len(unrecognized) > 0 {
+		fmt.Printf("%d Anime Offline Database source URLs are not recognized by any provider\n", len(unrecognized))
+	}
+
 	if err = otame.CreateAniDBTables(); err != nil {
 		panic(err)
 	}
@@ -133,4 +176,16 @@ func main() {
 	if err = otame.ReplaceAniDBEntriesFromIterator(anidbDecoder); err != nil {
 		panic(err)
 	}
+
+	if err = otame.CreateUserAliasTables(); err != nil {
+		panic(err)
+	}
+
+	if *aliasesPath != "" {
+		fmt.Println("Adding user aliases...")
+
+		if err = otame.LoadUserAliasesFile(*aliasesPath); err != nil {
+			panic(err)
+		}
+	}
 }
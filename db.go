@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
-	nurl "net/url"
 	"strings"
 	"time"
 )
@@ -95,6 +94,82 @@ func getLiveRangeOfTable(tableName string) (firstID int64, lastID int64, err err
 	return
 }
 
+// Returns the tables that do not exist yet.
+func missingTables(names ...string) (missing []string, err error) {
+	for _, name := range names {
+		var exists bool
+		err = db.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)
+		`, name).Scan(&exists)
+
+		if err != nil {
+			return
+		}
+
+		if !exists {
+			missing = append(missing, name)
+		}
+	}
+
+	return
+}
+
+// Reports whether the table has no column of that name,
+// for columns added to tables of existing databases.
+func missingColumn(table string, column string) (missing bool, err error) {
+	err = db.QueryRow(`
+		SELECT NOT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)
+	`, table, column).Scan(&missing)
+
+	return
+}
+
+// Drops the index of romaji generated for the kana titles of table, with
+// its vocabulary and the trigger filling it, if they predate the splitting
+// of titles into words, see generatedRomaji, so that they are created and
+// populated again.
+func dropUnsplitRomajiIndex(table string) (err error) {
+	var trigger string
+	err = db.QueryRow(`
+		SELECT sql FROM sqlite_master WHERE type = 'trigger' AND name = ?
+	`, table+"_after_insert_romaji").Scan(&trigger)
+
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil || strings.Contains(trigger, "generated_romaji") {
+		return
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`
+		DROP TRIGGER %[1]s_after_insert_romaji;
+		DROP TABLE IF EXISTS %[1]s_romaji_fts_vocab;
+		DROP TABLE IF EXISTS %[1]s_romaji_fts_idx;
+	`, table))
+
+	return
+}
+
+// Fills FTS indexes, and other tables derived from titles, added to an
+// existing database, using their statement in statements, or else
+// rebuilding them from their external content table.
+func populateFTSIndexes(names []string, statements map[string]string) (err error) {
+	for _, name := range names {
+		statement, ok := statements[name]
+
+		if !ok {
+			statement = fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", name, name)
+		}
+
+		if _, err = db.Exec(statement); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
 func killAllUpdatesForTable(tx *sql.Tx, tableName string) (err error) {
 	_, err = tx.Exec(`
 		UPDATE meta_updates
@@ -188,7 +263,11 @@ func CreateAllDBTables() (err error) {
 		return
 	}
 
-	err = CreateVNDBTables()
+	if err = CreateVNDBTables(); err != nil {
+		return
+	}
+
+	err = CreateUserAliasTables()
 
 	return
 }
@@ -199,6 +278,20 @@ func NewDBTransaction() (tx *sql.Tx, err error) {
 }
 
 func CreateAnimeOfflineDatabaseTables() (err error) {
+	if err = addAnimeOfflineDatabaseSynonymsIDColumn(); err != nil {
+		return
+	}
+
+	missing, err := missingTables(
+		"anime_offline_database_acronyms",
+		"anime_offline_database_fts_idx",
+		"anime_offline_database_synonyms_fts_idx",
+	)
+
+	if err != nil {
+		return
+	}
+
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS anime_offline_database (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -213,6 +306,7 @@ func CreateAnimeOfflineDatabaseTables() (err error) {
 		);
 		
 		CREATE TABLE IF NOT EXISTS anime_offline_database_synonyms (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			anime_offline_database_id INTEGER NOT NULL,
 			synonym TEXT NOT NULL,
 			FOREIGN KEY(anime_offline_database_id) REFERENCES anime_offline_database(id)
@@ -250,6 +344,9 @@ func CreateAnimeOfflineDatabaseTables() (err error) {
 			source_name TEXT NOT NULL,
 			source_url TEXT NOT NULL,
 			source_id TEXT NOT NULL,
+			-- false for URLs no registered provider parses, whose source_name
+			-- and source_id are the hostname and the path and query
+			recognized BOOLEAN NOT NULL DEFAULT TRUE,
 			FOREIGN KEY(anime_offline_database_id) REFERENCES anime_offline_database(id)
 		);
 
@@ -262,7 +359,317 @@ func CreateAnimeOfflineDatabaseTables() (err error) {
 			anime_offline_database_sources_source_id_and_source_name_idx
 		ON
 			anime_offline_database_sources(source_id, source_name);
+
+		CREATE TABLE IF NOT EXISTS anime_offline_database_scores (
+			anime_offline_database_id INTEGER PRIMARY KEY NOT NULL,
+			arithmetic_geometric_mean REAL NOT NULL,
+			arithmetic_mean REAL NOT NULL,
+			median REAL NOT NULL,
+			FOREIGN KEY(anime_offline_database_id) REFERENCES anime_offline_database(id)
+		);
+
+		-- acronyms of titles and synonyms, see TitleAcronyms
+		CREATE TABLE IF NOT EXISTS anime_offline_database_acronyms (
+			anime_offline_database_id INTEGER NOT NULL,
+			acronym TEXT NOT NULL,
+			UNIQUE(acronym, anime_offline_database_id),
+			FOREIGN KEY(anime_offline_database_id) REFERENCES anime_offline_database(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS
+			anime_offline_database_acronyms_anime_offline_database_id_idx
+		ON
+			anime_offline_database_acronyms(anime_offline_database_id);
+
+		CREATE TRIGGER IF NOT EXISTS anime_offline_database_after_insert_acronyms
+		AFTER INSERT ON anime_offline_database
+		BEGIN
+			INSERT OR IGNORE INTO anime_offline_database_acronyms(anime_offline_database_id, acronym)
+			SELECT new.id, value FROM json_each(title_acronyms(new.title));
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS anime_offline_database_synonyms_after_insert_acronyms
+		AFTER INSERT ON anime_offline_database_synonyms
+		BEGIN
+			INSERT OR IGNORE INTO anime_offline_database_acronyms(anime_offline_database_id, acronym)
+			SELECT new.anime_offline_database_id, value FROM json_each(title_acronyms(new.synonym));
+		END;
+
+		-- acronyms also made by the title or another synonym are kept
+		CREATE TRIGGER IF NOT EXISTS anime_offline_database_synonyms_before_delete_acronyms
+		BEFORE DELETE ON anime_offline_database_synonyms
+		BEGIN
+			DELETE FROM anime_offline_database_acronyms
+			WHERE anime_offline_database_id = old.anime_offline_database_id
+			AND acronym IN (SELECT value FROM json_each(title_acronyms(old.synonym)))
+			AND acronym NOT IN (
+				SELECT value FROM anime_offline_database, json_each(title_acronyms(title))
+				WHERE anime_offline_database.id = old.anime_offline_database_id
+				UNION ALL
+				SELECT value FROM anime_offline_database_synonyms, json_each(title_acronyms(synonym))
+				WHERE anime_offline_database_synonyms.anime_offline_database_id = old.anime_offline_database_id
+				AND anime_offline_database_synonyms.id != old.id
+			);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS anime_offline_database_before_delete_acronyms
+		BEFORE DELETE ON anime_offline_database
+		BEGIN
+			DELETE FROM anime_offline_database_acronyms WHERE anime_offline_database_id = old.id;
+		END;
+
+		CREATE VIRTUAL TABLE IF NOT EXISTS anime_offline_database_fts_idx USING fts4(
+			title,
+			content='anime_offline_database',
+			tokenize=icu root
+		);
+
+		-- docids are IDs of synonyms, not of entries
+		CREATE VIRTUAL TABLE IF NOT EXISTS anime_offline_database_synonyms_fts_idx USING fts4(
+			synonym,
+			content='anime_offline_database_synonyms',
+			tokenize=icu root
+		);
+
+		CREATE VIRTUAL TABLE IF NOT EXISTS anime_offline_database_fts_vocab USING fts4aux(anime_offline_database_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS anime_offline_database_synonyms_fts_vocab USING fts4aux(anime_offline_database_synonyms_fts_idx);
+
+		CREATE TRIGGER IF NOT EXISTS anime_offline_database_after_insert_fts AFTER INSERT ON anime_offline_database
+		BEGIN
+			INSERT INTO anime_offline_database_fts_idx(docid, title) VALUES (new.id, new.title);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS anime_offline_database_before_delete_fts BEFORE DELETE ON anime_offline_database
+		BEGIN
+			DELETE FROM anime_offline_database_fts_idx WHERE docid = old.id;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS anime_offline_database_synonyms_after_insert_fts
+		AFTER INSERT ON anime_offline_database_synonyms
+		BEGIN
+			INSERT INTO anime_offline_database_synonyms_fts_idx(docid, synonym) VALUES (new.id, new.synonym);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS anime_offline_database_synonyms_before_delete_fts
+		BEFORE DELETE ON anime_offline_database_synonyms
+		BEGIN
+			DELETE FROM anime_offline_database_synonyms_fts_idx WHERE docid = old.id;
+		END;
 	`)
+
+	if err != nil {
+		return
+	}
+
+	if err = addAnimeOfflineDatabaseSourcesRecognizedColumn(); err != nil {
+		return
+	}
+
+	err = populateFTSIndexes(missing, map[string]string{
+		"anime_offline_database_acronyms": `
+			INSERT OR IGNORE INTO anime_offline_database_acronyms(anime_offline_database_id, acronym)
+			SELECT anime_offline_database.id, value FROM anime_offline_database, json_each(title_acronyms(title))
+			UNION ALL
+			SELECT anime_offline_database_id, value FROM anime_offline_database_synonyms, json_each(title_acronyms(synonym))
+		`,
+	})
+
+	return
+}
+
+// Adds the id column to the synonyms of databases created before it, whose
+// FTS index was keyed on their implicit rowids. As a column cannot be made
+// the primary key of an existing table, the table is copied, keeping the
+// rowids as IDs, and its indexes and triggers are then created again.
+func addAnimeOfflineDatabaseSynonymsIDColumn() (err error) {
+	missing, err := missingTables("anime_offline_database_synonyms")
+
+	if err != nil || len(missing) > 0 {
+		return
+	}
+
+	missingID, err := missingColumn("anime_offline_database_synonyms", "id")
+
+	if err != nil || !missingID {
+		return
+	}
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		CREATE TABLE anime_offline_database_synonyms_with_id (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			anime_offline_database_id INTEGER NOT NULL,
+			synonym TEXT NOT NULL,
+			FOREIGN KEY(anime_offline_database_id) REFERENCES anime_offline_database(id)
+		);
+
+		INSERT INTO anime_offline_database_synonyms_with_id(id, anime_offline_database_id, synonym)
+		SELECT rowid, anime_offline_database_id, synonym FROM anime_offline_database_synonyms;
+
+		DROP TABLE anime_offline_database_synonyms;
+
+		ALTER TABLE anime_offline_database_synonyms_with_id RENAME TO anime_offline_database_synonyms;
+	`)
+
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+
+	return
+}
+
+// Adds the recognized column to the sources of databases created before it,
+// parsing their URLs again with ParseAnimeOfflineDatabaseSource, so that
+// their provider names and IDs are normalized like those of new sources
+// and the URLs not recognized by the registered anime providers are
+// flagged. Sources which then turn out to be duplicates are removed.
+func addAnimeOfflineDatabaseSourcesRecognizedColumn() (err error) {
+	missing, err := missingColumn("anime_offline_database_sources", "recognized")
+
+	if err != nil || !missing {
+		return
+	}
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return
+	}
+
+	defer tx.Rollback()
+
+	// the index is created again once sources are rewritten, as
+	// rewriting them one by one may collide with those left to rewrite
+	_, err = tx.Exec(`
+		ALTER TABLE anime_offline_database_sources
+		ADD COLUMN recognized BOOLEAN NOT NULL DEFAULT TRUE;
+
+		DROP INDEX IF EXISTS anime_offline_database_sources_source_id_and_source_name_idx;
+	`)
+
+	if err != nil {
+		return
+	}
+
+	rows, err := tx.Query("SELECT rowid, source_url FROM anime_offline_database_sources")
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	sources := make(map[int64]AnimeOfflineDatabaseSource)
+
+	for rows.Next() {
+		var rowID int64
+		var sourceURL string
+
+		if err = rows.Scan(&rowID, &sourceURL); err != nil {
+			return
+		}
+
+		// URLs that do not parse at all are left unrecognized,
+		// with an empty provider name and ID keeping the stored ones
+		sources[rowID], _ = ParseAnimeOfflineDatabaseSource(sourceURL)
+	}
+
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	rows.Close()
+
+	for rowID, source := range sources {
+		_, err = tx.Exec(`
+			UPDATE anime_offline_database_sources
+			SET
+				source_name = COALESCE(NULLIF(?, ''), source_name),
+				source_id = COALESCE(NULLIF(?, ''), source_id),
+				recognized = ?
+			WHERE rowid = ?
+		`, string(source.Provider), source.ID, source.Recognized, rowID)
+
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM anime_offline_database_sources
+		WHERE rowid NOT IN (
+			SELECT MIN(rowid) FROM anime_offline_database_sources
+			GROUP BY source_id, source_name
+		);
+
+		CREATE UNIQUE INDEX
+			anime_offline_database_sources_source_id_and_source_name_idx
+		ON
+			anime_offline_database_sources(source_id, source_name);
+	`)
+
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+
+	return
+}
+
+// Returns the sources of live entries no registered provider recognizes,
+// see AnimeOfflineDatabaseSource.Recognized.
+func GetUnrecognizedAnimeOfflineDatabaseSources() (sources []AnimeOfflineDatabaseSource, err error) {
+	firstID, lastID, err := getLiveRangeOfTable("anime_offline_database")
+
+	if err != nil {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			anime_offline_database_sources.source_name,
+			anime_offline_database_sources.source_id,
+			anime_offline_database_sources.source_url
+		FROM
+			anime_offline_database_sources
+		WHERE
+			anime_offline_database_sources.recognized = FALSE
+		AND
+			anime_offline_database_sources.anime_offline_database_id BETWEEN ? AND ?
+		ORDER BY
+			anime_offline_database_sources.rowid
+	`, firstID, lastID)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var source AnimeOfflineDatabaseSource
+		var provider string
+
+		if err = rows.Scan(&provider, &source.ID, &source.URL); err != nil {
+			return
+		}
+
+		source.Provider = Provider(provider)
+		sources = append(sources, source)
+	}
+
+	err = rows.Err()
+
 	return
 }
 
@@ -297,6 +704,12 @@ func DeleteAllAnimeOfflineDatabaseEntriesWithTx(tx *sql.Tx) (err error) {
 		return
 	}
 
+	_, err = tx.Exec("DELETE FROM anime_offline_database_scores")
+
+	if err != nil {
+		return
+	}
+
 	err = killAllUpdatesForTable(tx, "anime_offline_database")
 
 	return
@@ -414,8 +827,9 @@ func CreateAnimeOfflineDatabaseEntryWithTx(tx *sql.Tx, entry AnimeOfflineDatabas
 			anime_offline_database_id,
 			source_name,
 			source_url,
-			source_id
-		) VALUES (?, ?, ?, ?)
+			source_id,
+			recognized
+		) VALUES (?, ?, ?, ?, ?)
 	`)
 
 	if err != nil {
@@ -424,23 +838,37 @@ func CreateAnimeOfflineDatabaseEntryWithTx(tx *sql.Tx, entry AnimeOfflineDatabas
 
 	defer stmt.Close()
 
-	for _, source := range entry.Sources {
-		var url *nurl.URL
-		url, err = nurl.Parse(source)
+	for _, sourceURL := range entry.Sources {
+		// unrecognized URLs are still stored, using the fallback provider
+		// name and ID of ParseAnimeOfflineDatabaseSource, but flagged so
+		// that lookups by source skip them
+		var source AnimeOfflineDatabaseSource
+		source, err = ParseAnimeOfflineDatabaseSource(sourceURL)
 
 		if err != nil {
 			return
 		}
 
-		sourceID := url.Path[strings.LastIndex(url.Path, "/")+1:]
-
-		_, err = stmt.Exec(id, url.Hostname(), source, sourceID)
+		_, err = stmt.Exec(id, string(source.Provider), sourceURL, source.ID, source.Recognized)
 
 		if err != nil {
 			return
 		}
 	}
 
+	if entry.Score == nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO anime_offline_database_scores (
+			anime_offline_database_id,
+			arithmetic_geometric_mean,
+			arithmetic_mean,
+			median
+		) VALUES (?, ?, ?, ?)
+	`, id, entry.Score.ArithmeticGeometricMean, entry.Score.ArithmeticMean, entry.Score.Median)
+
 	return
 }
 
@@ -479,6 +907,12 @@ func UpdateAnimeOfflineDatabaseEntriesFromIterator[
 		return
 	}
 
+	_, err = tx.Exec("DELETE FROM anime_offline_database_scores")
+
+	if err != nil {
+		return
+	}
+
 	var entry AnimeOfflineDatabaseEntry
 	entry, err = iter.Next()
 
@@ -566,6 +1000,21 @@ func ReplaceAnimeOfflineDatabaseEntriesFromIterator[
 }
 
 func CreateAniDBTables() (err error) {
+	if err = dropUnsplitRomajiIndex("anidb_titles"); err != nil {
+		return
+	}
+
+	missing, err := missingTables(
+		"anidb_titles_all_fts_idx",
+		"anidb_titles_romaji_fts_idx",
+		"anidb_titles_x_jat_norm_fts_idx",
+		"anidb_title_acronyms",
+	)
+
+	if err != nil {
+		return
+	}
+
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS anidb_titles (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -577,6 +1026,16 @@ func CreateAniDBTables() (err error) {
 
 		CREATE INDEX IF NOT EXISTS anidb_titles_aid_idx ON anidb_titles(aid);
 
+		-- acronyms of English and romaji titles, see TitleAcronyms
+		CREATE TABLE IF NOT EXISTS anidb_title_acronyms (
+			title_id INTEGER NOT NULL,
+			acronym TEXT NOT NULL,
+			FOREIGN KEY(title_id) REFERENCES anidb_titles(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS anidb_title_acronyms_acronym_idx ON anidb_title_acronyms(acronym, title_id);
+		CREATE INDEX IF NOT EXISTS anidb_title_acronyms_title_id_idx ON anidb_title_acronyms(title_id);
+
 		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_x_jat_fts_idx USING fts4(
 			title,
 			content='anidb_titles',
@@ -595,12 +1054,46 @@ func CreateAniDBTables() (err error) {
 			tokenize=icu en
 		);
 
+		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_all_fts_idx USING fts4(
+			title,
+			content='anidb_titles',
+			tokenize=icu root
+		);
+
+		-- romaji titles, normalized with normalize_romaji
+		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_x_jat_norm_fts_idx USING fts4(
+			title,
+			tokenize='simple'
+		);
+
+		-- normalized romaji generated for kana titles of anime without a romaji title
+		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_romaji_fts_idx USING fts4(
+			romaji,
+			tokenize='simple'
+		);
+
+		-- splits kana titles into words for the generated romaji, see generatedRomaji
+		CREATE VIRTUAL TABLE IF NOT EXISTS kana_tokenizer USING fts3tokenize(icu, ja);
+
+		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_x_jat_fts_vocab USING fts4aux(anidb_titles_x_jat_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_ja_fts_vocab USING fts4aux(anidb_titles_ja_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_en_fts_vocab USING fts4aux(anidb_titles_en_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_all_fts_vocab USING fts4aux(anidb_titles_all_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_x_jat_norm_fts_vocab USING fts4aux(anidb_titles_x_jat_norm_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS anidb_titles_romaji_fts_vocab USING fts4aux(anidb_titles_romaji_fts_idx);
+
 		CREATE TRIGGER IF NOT EXISTS anidb_titles_after_insert_x_jat AFTER INSERT ON anidb_titles
 		WHEN new.language = 'x_jat'
 		BEGIN
 			INSERT INTO anidb_titles_x_jat_fts_idx(docid, title) VALUES (new.id, new.title);
 		END;
 
+		CREATE TRIGGER IF NOT EXISTS anidb_titles_after_insert_x_jat_norm AFTER INSERT ON anidb_titles
+		WHEN new.language = 'x_jat'
+		BEGIN
+			INSERT INTO anidb_titles_x_jat_norm_fts_idx(docid, title) VALUES (new.id, normalize_romaji(new.title));
+		END;
+
 		CREATE TRIGGER IF NOT EXISTS anidb_titles_after_insert_ja AFTER INSERT ON anidb_titles
 		WHEN new.language = 'ja'
 		BEGIN
@@ -613,12 +1106,50 @@ func CreateAniDBTables() (err error) {
 			INSERT INTO anidb_titles_en_fts_idx(docid, title) VALUES (new.id, new.title);
 		END;
 
+		CREATE TRIGGER IF NOT EXISTS anidb_titles_after_insert_all AFTER INSERT ON anidb_titles
+		BEGIN
+			INSERT INTO anidb_titles_all_fts_idx(docid, title) VALUES (new.id, new.title);
+		END;
+
+		-- titles inserted since the last update belong to the one in progress
+		CREATE TRIGGER IF NOT EXISTS anidb_titles_after_insert_romaji AFTER INSERT ON anidb_titles
+		WHEN new.language = 'ja' AND is_kana(new.title) AND NOT EXISTS (
+			SELECT 1 FROM anidb_titles
+			WHERE aid = new.aid
+			AND language = 'x_jat'
+			AND id > COALESCE((SELECT MAX(last_id) FROM meta_updates WHERE table_name = 'anidb_titles'), 0)
+		)
+		BEGIN
+			INSERT INTO anidb_titles_romaji_fts_idx(docid, romaji) VALUES (new.id, generated_romaji(new.title, (
+				SELECT group_concat(token, ' ') FROM (
+					SELECT token FROM kana_tokenizer WHERE input = new.title ORDER BY position
+				)
+			)));
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS anidb_titles_after_insert_x_jat_romaji AFTER INSERT ON anidb_titles
+		WHEN new.language = 'x_jat'
+		BEGIN
+			DELETE FROM anidb_titles_romaji_fts_idx WHERE docid IN (
+				SELECT id FROM anidb_titles
+				WHERE aid = new.aid
+				AND language = 'ja'
+				AND id > COALESCE((SELECT MAX(last_id) FROM meta_updates WHERE table_name = 'anidb_titles'), 0)
+			);
+		END;
+
 		CREATE TRIGGER IF NOT EXISTS anidb_titles_before_delete_x_jat BEFORE DELETE ON anidb_titles
 		WHEN old.language = 'x_jat'
 		BEGIN
   			DELETE FROM anidb_titles_x_jat_fts_idx WHERE docid = old.id;
 		END;
 
+		CREATE TRIGGER IF NOT EXISTS anidb_titles_before_delete_x_jat_norm BEFORE DELETE ON anidb_titles
+		WHEN old.language = 'x_jat'
+		BEGIN
+			DELETE FROM anidb_titles_x_jat_norm_fts_idx WHERE docid = old.id;
+		END;
+
 		CREATE TRIGGER IF NOT EXISTS anidb_titles_before_delete_ja BEFORE DELETE ON anidb_titles
 		WHEN old.language = 'ja'
 		BEGIN
@@ -630,8 +1161,66 @@ func CreateAniDBTables() (err error) {
 		BEGIN
 			DELETE FROM anidb_titles_en_fts_idx WHERE docid = old.id;
 		END;
+
+		CREATE TRIGGER IF NOT EXISTS anidb_titles_before_delete_all BEFORE DELETE ON anidb_titles
+		BEGIN
+			DELETE FROM anidb_titles_all_fts_idx WHERE docid = old.id;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS anidb_titles_before_delete_romaji BEFORE DELETE ON anidb_titles
+		BEGIN
+			DELETE FROM anidb_titles_romaji_fts_idx WHERE docid = old.id;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS anidb_titles_after_insert_acronyms AFTER INSERT ON anidb_titles
+		WHEN new.language IN ('en', 'x_jat')
+		BEGIN
+			INSERT INTO anidb_title_acronyms(title_id, acronym)
+			SELECT new.id, value FROM json_each(title_acronyms(new.title));
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS anidb_titles_before_delete_acronyms BEFORE DELETE ON anidb_titles
+		WHEN old.language IN ('en', 'x_jat')
+		BEGIN
+			DELETE FROM anidb_title_acronyms WHERE title_id = old.id;
+		END;
 	`)
 
+	if err != nil {
+		return
+	}
+
+	err = populateFTSIndexes(missing, map[string]string{
+		"anidb_title_acronyms": `
+			INSERT INTO anidb_title_acronyms(title_id, acronym)
+			SELECT anidb_titles.id, value
+			FROM anidb_titles, json_each(title_acronyms(title))
+			WHERE language IN ('en', 'x_jat')
+		`,
+		"anidb_titles_x_jat_norm_fts_idx": `
+			INSERT INTO anidb_titles_x_jat_norm_fts_idx(docid, title)
+			SELECT id, normalize_romaji(title)
+			FROM anidb_titles
+			WHERE language = 'x_jat'
+		`,
+		"anidb_titles_romaji_fts_idx": `
+			INSERT INTO anidb_titles_romaji_fts_idx(docid, romaji)
+			SELECT id, generated_romaji(title, (
+				SELECT group_concat(token, ' ') FROM (
+					SELECT token FROM kana_tokenizer WHERE input = kana_titles.title ORDER BY position
+				)
+			))
+			FROM anidb_titles AS kana_titles
+			WHERE language = 'ja'
+			AND is_kana(title)
+			AND NOT EXISTS (
+				SELECT 1 FROM anidb_titles
+				WHERE aid = kana_titles.aid
+				AND language = 'x_jat'
+			)
+		`,
+	})
+
 	return
 }
 
@@ -774,6 +1363,22 @@ func CreateAniDBEntryWithTx(tx *sql.Tx, entry AniDBEntry) (id int64, err error)
 }
 
 func CreateVNDBTables() (err error) {
+	if err = dropUnsplitRomajiIndex("vndb_titles"); err != nil {
+		return
+	}
+
+	missing, err := missingTables(
+		"vndb_titles_all_fts_idx",
+		"vndb_titles_latin_fts_idx",
+		"vndb_titles_latin_norm_fts_idx",
+		"vndb_titles_romaji_fts_idx",
+		"vndb_title_acronyms",
+	)
+
+	if err != nil {
+		return
+	}
+
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS vndb_visual_novels (
 			vnid TEXT PRIMARY KEY NOT NULL,
@@ -782,6 +1387,13 @@ func CreateVNDBTables() (err error) {
 			FOREIGN KEY(image_id) REFERENCES vndb_images(id)
 		);
 
+		CREATE TABLE IF NOT EXISTS vndb_visual_novel_stats (
+			vnid TEXT PRIMARY KEY NOT NULL,
+			vote_count INTEGER NOT NULL,
+			rating INTEGER,
+			FOREIGN KEY(vnid) REFERENCES vndb_visual_novels(vnid)
+		);
+
 		CREATE TABLE IF NOT EXISTS vndb_titles (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			vnid TEXT NOT NULL,
@@ -794,6 +1406,16 @@ func CreateVNDBTables() (err error) {
 
 		CREATE INDEX IF NOT EXISTS vndb_titles_vnid_idx ON vndb_titles(vnid);
 
+		-- acronyms of romanized or English titles, see TitleAcronyms
+		CREATE TABLE IF NOT EXISTS vndb_title_acronyms (
+			title_id INTEGER NOT NULL,
+			acronym TEXT NOT NULL,
+			FOREIGN KEY(title_id) REFERENCES vndb_titles(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS vndb_title_acronyms_acronym_idx ON vndb_title_acronyms(acronym, title_id);
+		CREATE INDEX IF NOT EXISTS vndb_title_acronyms_title_id_idx ON vndb_title_acronyms(title_id);
+
 		CREATE TABLE IF NOT EXISTS vndb_images (
 			id TEXT PRIMARY KEY NOT NULL,
 			width INTEGER NOT NULL,
@@ -804,6 +1426,28 @@ func CreateVNDBTables() (err error) {
 			violence_dev INTEGER NOT NULL
 		);
 
+		CREATE TABLE IF NOT EXISTS vndb_releases_visual_novels (
+			release_id TEXT NOT NULL,
+			vnid TEXT NOT NULL,
+			FOREIGN KEY(vnid) REFERENCES vndb_visual_novels(vnid)
+		);
+
+		CREATE INDEX IF NOT EXISTS
+			vndb_releases_visual_novels_release_id_idx
+		ON
+			vndb_releases_visual_novels(release_id);
+
+		CREATE TABLE IF NOT EXISTS vndb_characters_visual_novels (
+			character_id TEXT NOT NULL,
+			vnid TEXT NOT NULL,
+			FOREIGN KEY(vnid) REFERENCES vndb_visual_novels(vnid)
+		);
+
+		CREATE INDEX IF NOT EXISTS
+			vndb_characters_visual_novels_character_id_idx
+		ON
+			vndb_characters_visual_novels(character_id);
+
 		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_ja_fts_idx USING fts4(
 			title,
 			content='vndb_titles',
@@ -816,6 +1460,40 @@ func CreateVNDBTables() (err error) {
 			tokenize=icu en
 		);
 
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_all_fts_idx USING fts4(
+			title,
+			content='vndb_titles',
+			tokenize=icu root
+		);
+
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_latin_fts_idx USING fts4(
+			latin,
+			content='vndb_titles',
+			tokenize='simple'
+		);
+
+		-- romanizations, normalized with normalize_romaji
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_latin_norm_fts_idx USING fts4(
+			latin,
+			tokenize='simple'
+		);
+
+		-- normalized romaji generated for kana titles without a romanization
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_romaji_fts_idx USING fts4(
+			romaji,
+			tokenize='simple'
+		);
+
+		-- splits kana titles into words for the generated romaji, see generatedRomaji
+		CREATE VIRTUAL TABLE IF NOT EXISTS kana_tokenizer USING fts3tokenize(icu, ja);
+
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_ja_fts_vocab USING fts4aux(vndb_titles_ja_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_en_fts_vocab USING fts4aux(vndb_titles_en_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_all_fts_vocab USING fts4aux(vndb_titles_all_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_latin_fts_vocab USING fts4aux(vndb_titles_latin_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_latin_norm_fts_vocab USING fts4aux(vndb_titles_latin_norm_fts_idx);
+		CREATE VIRTUAL TABLE IF NOT EXISTS vndb_titles_romaji_fts_vocab USING fts4aux(vndb_titles_romaji_fts_idx);
+
 		CREATE TRIGGER IF NOT EXISTS vndb_titles_after_insert_ja AFTER INSERT ON vndb_titles
 		WHEN new.language = 'ja'
 		BEGIN
@@ -828,6 +1506,33 @@ func CreateVNDBTables() (err error) {
 			INSERT INTO vndb_titles_en_fts_idx(docid, title) VALUES (new.id, new.title);
 		END;
 
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_after_insert_all AFTER INSERT ON vndb_titles
+		BEGIN
+			INSERT INTO vndb_titles_all_fts_idx(docid, title) VALUES (new.id, new.title);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_after_insert_latin AFTER INSERT ON vndb_titles
+		WHEN new.latin IS NOT NULL
+		BEGIN
+			INSERT INTO vndb_titles_latin_fts_idx(docid, latin) VALUES (new.id, new.latin);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_after_insert_latin_norm AFTER INSERT ON vndb_titles
+		WHEN new.latin IS NOT NULL
+		BEGIN
+			INSERT INTO vndb_titles_latin_norm_fts_idx(docid, latin) VALUES (new.id, normalize_romaji(new.latin));
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_after_insert_romaji AFTER INSERT ON vndb_titles
+		WHEN new.latin IS NULL AND is_kana(new.title)
+		BEGIN
+			INSERT INTO vndb_titles_romaji_fts_idx(docid, romaji) VALUES (new.id, generated_romaji(new.title, (
+				SELECT group_concat(token, ' ') FROM (
+					SELECT token FROM kana_tokenizer WHERE input = new.title ORDER BY position
+				)
+			)));
+		END;
+
 		CREATE TRIGGER IF NOT EXISTS vndb_titles_before_delete_ja BEFORE DELETE ON vndb_titles
 		WHEN old.language = 'ja'
 		BEGIN
@@ -839,14 +1544,85 @@ func CreateVNDBTables() (err error) {
 		BEGIN
 			DELETE FROM vndb_titles_en_fts_idx WHERE docid = old.id;
 		END;
+
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_before_delete_all BEFORE DELETE ON vndb_titles
+		BEGIN
+			DELETE FROM vndb_titles_all_fts_idx WHERE docid = old.id;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_before_delete_latin BEFORE DELETE ON vndb_titles
+		WHEN old.latin IS NOT NULL
+		BEGIN
+			DELETE FROM vndb_titles_latin_fts_idx WHERE docid = old.id;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_before_delete_latin_norm BEFORE DELETE ON vndb_titles
+		WHEN old.latin IS NOT NULL
+		BEGIN
+			DELETE FROM vndb_titles_latin_norm_fts_idx WHERE docid = old.id;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_before_delete_romaji BEFORE DELETE ON vndb_titles
+		BEGIN
+			DELETE FROM vndb_titles_romaji_fts_idx WHERE docid = old.id;
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_after_insert_acronyms AFTER INSERT ON vndb_titles
+		WHEN new.latin IS NOT NULL OR new.language = 'en'
+		BEGIN
+			INSERT INTO vndb_title_acronyms(title_id, acronym)
+			SELECT new.id, value FROM json_each(title_acronyms(COALESCE(new.latin, new.title)));
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS vndb_titles_before_delete_acronyms BEFORE DELETE ON vndb_titles
+		WHEN old.latin IS NOT NULL OR old.language = 'en'
+		BEGIN
+			DELETE FROM vndb_title_acronyms WHERE title_id = old.id;
+		END;
 	`)
 
+	if err != nil {
+		return
+	}
+
+	err = populateFTSIndexes(missing, map[string]string{
+		"vndb_title_acronyms": `
+			INSERT INTO vndb_title_acronyms(title_id, acronym)
+			SELECT vndb_titles.id, value
+			FROM vndb_titles, json_each(title_acronyms(COALESCE(latin, title)))
+			WHERE latin IS NOT NULL OR language = 'en'
+		`,
+		"vndb_titles_latin_norm_fts_idx": `
+			INSERT INTO vndb_titles_latin_norm_fts_idx(docid, latin)
+			SELECT id, normalize_romaji(latin)
+			FROM vndb_titles
+			WHERE latin IS NOT NULL
+		`,
+		"vndb_titles_romaji_fts_idx": `
+			INSERT INTO vndb_titles_romaji_fts_idx(docid, romaji)
+			SELECT id, generated_romaji(title, (
+				SELECT group_concat(token, ' ') FROM (
+					SELECT token FROM kana_tokenizer WHERE input = vndb_titles.title ORDER BY position
+				)
+			))
+			FROM vndb_titles
+			WHERE latin IS NULL
+			AND is_kana(title)
+		`,
+	})
+
 	return
 }
 
 func DeleteAllVNDBVisualNovelEntriesWithTx(tx *sql.Tx) (err error) {
 	_, err = tx.Exec("DELETE FROM vndb_visual_novels")
 
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM vndb_visual_novel_stats")
+
 	return
 }
 
@@ -912,6 +1688,18 @@ func CreateVNDBVisualNovelEntryWithTx(tx *sql.Tx, entry VNDBVisualNovelEntry) (e
 		entry.ImageID,
 	)
 
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO vndb_visual_novel_stats (
+			vnid,
+			vote_count,
+			rating
+		) VALUES (?, ?, ?)
+	`, entry.ID, entry.VoteCount, entry.Rating)
+
 	return
 }
 
@@ -1140,109 +1928,133 @@ func ReplaceVNDBImageEntriesFromIterator[
 	return
 }
 
-// idxTableName should only be used with constant strings of value:
-// "anidb_titles_ja_fts_idx", "anidb_titles_en_fts_idx", or "anidb_titles_x_jat_fts_idx"
-func searchAniDBTitleIndex(query string, limit int, idxTableName string) (entries []AniDBEntry, err error) {
-	firstID, lastID, err := getLiveRangeOfTable("anidb_titles")
+func DeleteAllVNDBReleaseVisualNovelEntriesWithTx(tx *sql.Tx) (err error) {
+	_, err = tx.Exec("DELETE FROM vndb_releases_visual_novels")
+
+	return
+}
+
+func CreateVNDBReleaseVisualNovelEntryWithTx(tx *sql.Tx, entry VNDBReleaseVisualNovelEntry) (err error) {
+	var stmt *sql.Stmt
+	stmt, err = tx.Prepare(`
+		INSERT INTO vndb_releases_visual_novels (
+			release_id,
+			vnid
+		) VALUES (?, ?)
+	`)
 
 	if err != nil {
 		return
 	}
 
-	// get docids from fts index and join with anidb_titles
-	querySQL := fmt.Sprintf(`
-		SELECT
-			anidb_titles.id,
-			anidb_titles.aid,
-			anidb_titles.type,
-			anidb_titles.title,
-			anidb_titles.language
-		FROM
-			anidb_titles
-		JOIN (
-			SELECT docid, rank(matchinfo(%s)) AS rank
-			FROM %s
-			WHERE title MATCH ?
-			AND docid BETWEEN ? AND ?
-			ORDER BY rank DESC
-			LIMIT ?
-		) AS matches ON matches.docid = anidb_titles.id
-	`, idxTableName, idxTableName)
+	defer stmt.Close()
+
+	_, err = stmt.Exec(entry.ReleaseID, entry.VNID)
+
+	return
+}
 
-	rows, err := db.Query(querySQL, query, firstID, lastID, limit)
+func ReplaceVNDBReleaseVisualNovelEntriesFromIterator[
+	T RowIterator[VNDBReleaseVisualNovelEntry],
+](iter T) (err error) {
+	tx, err := db.Begin()
 
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
+	defer tx.Rollback()
 
-	for rows.Next() {
-		var entry AniDBEntry
-		err = rows.Scan(&entry.ID, &entry.AID, &entry.Type, &entry.Title, &entry.Language)
+	if err = DeleteAllVNDBReleaseVisualNovelEntriesWithTx(tx); err != nil {
+		return
+	}
+
+	for {
+		var entry VNDBReleaseVisualNovelEntry
+		entry, err = iter.Next()
+
+		if err == ErrEOF {
+			break
+		}
 
 		if err != nil {
 			return
 		}
 
-		entries = append(entries, entry)
+		err = CreateVNDBReleaseVisualNovelEntryWithTx(tx, entry)
+
+		if err != nil {
+			return
+		}
 	}
 
-	err = rows.Err()
+	err = tx.Commit()
 
 	return
 }
 
-func SearchAniDBJapaneseTitles(query string, limit int) ([]AniDBEntry, error) {
-	return searchAniDBTitleIndex(query, limit, "anidb_titles_ja_fts_idx")
-}
-
-func SearchAniDBEnglishTitles(query string, limit int) ([]AniDBEntry, error) {
-	return searchAniDBTitleIndex(query, limit, "anidb_titles_en_fts_idx")
-}
+func DeleteAllVNDBCharacterVisualNovelEntriesWithTx(tx *sql.Tx) (err error) {
+	_, err = tx.Exec("DELETE FROM vndb_characters_visual_novels")
 
-func SearchAniDBRomajiTitles(query string, limit int) ([]AniDBEntry, error) {
-	return searchAniDBTitleIndex(query, limit, "anidb_titles_x_jat_fts_idx")
+	return
 }
 
-// Prefers Japanese titles, then English titles, then romaji titles.
-func SearchAniDBTitles(query string, limit int) (entries []AniDBEntry, err error) {
-	jaEntries, err := SearchAniDBJapaneseTitles(query, limit)
+func CreateVNDBCharacterVisualNovelEntryWithTx(tx *sql.Tx, entry VNDBCharacterVisualNovelEntry) (err error) {
+	var stmt *sql.Stmt
+	stmt, err = tx.Prepare(`
+		INSERT INTO vndb_characters_visual_novels (
+			character_id,
+			vnid
+		) VALUES (?, ?)
+	`)
 
 	if err != nil {
 		return
 	}
 
-	entries = append(entries, jaEntries...)
+	defer stmt.Close()
 
-	if len(entries) >= limit {
-		return
-	}
+	_, err = stmt.Exec(entry.CharacterID, entry.VNID)
 
-	enEntries, err := SearchAniDBEnglishTitles(query, limit)
+	return
+}
+
+func ReplaceVNDBCharacterVisualNovelEntriesFromIterator[
+	T RowIterator[VNDBCharacterVisualNovelEntry],
+](iter T) (err error) {
+	tx, err := db.Begin()
 
 	if err != nil {
 		return
 	}
 
-	if len(entries) >= limit {
+	defer tx.Rollback()
+
+	if err = DeleteAllVNDBCharacterVisualNovelEntriesWithTx(tx); err != nil {
 		return
 	}
 
-	entries = append(entries, enEntries...)
+	for {
+		var entry VNDBCharacterVisualNovelEntry
+		entry, err = iter.Next()
 
-	romajiEntries, err := SearchAniDBRomajiTitles(query, limit)
+		if err == ErrEOF {
+			break
+		}
 
-	if err != nil {
-		return
-	}
+		if err != nil {
+			return
+		}
 
-	entries = append(entries, romajiEntries...)
+		err = CreateVNDBCharacterVisualNovelEntryWithTx(tx, entry)
 
-	if len(entries) >= limit {
-		entries = entries[:limit]
+		if err != nil {
+			return
+		}
 	}
 
+	err = tx.Commit()
+
 	return
 }
 
@@ -1347,18 +2159,25 @@ func GetAnimeOfflineDatabaseEntryByID(id string) (entry AnimeOfflineDatabaseEntr
 		return
 	}
 
-	err = appendDetailsToAnimeOfflineDatabaseEntry(id, &entry)
+	entry.ID = id
+	entries := []AnimeOfflineDatabaseEntry{entry}
+	err = appendDetailsToAnimeOfflineDatabaseEntries(entries)
+	entry = entries[0]
 
 	return
 }
 
 func GetAnimeOfflineDatabaseEntryByAID(aid string) (AnimeOfflineDatabaseEntry, error) {
-	return GetAnimeOfflineDatabaseEntryBySource("anidb.net", aid)
+	return GetAnimeOfflineDatabaseEntryBySource(string(ProviderAniDB), aid)
 }
 
+// sourceName is normalized with NormalizeProviderName, so it may be
+// either a Provider or a hostname such as "www.anidb.net".
 func GetAnimeOfflineDatabaseEntryBySource(sourceName string, sourceID string) (entry AnimeOfflineDatabaseEntry, err error) {
 	var id string
 
+	sourceName = string(NormalizeProviderName(sourceName))
+
 	row := db.QueryRow(`
 		SELECT
 			anime_offline_database.id,
@@ -1380,6 +2199,8 @@ func GetAnimeOfflineDatabaseEntryBySource(sourceName string, sourceID string) (e
 			anime_offline_database_sources.source_name = ?
 		AND
 			anime_offline_database_sources.source_id = ?
+		AND
+			anime_offline_database_sources.recognized
 	`, sourceName, sourceID)
 
 	err = row.Scan(
@@ -1398,135 +2219,119 @@ func GetAnimeOfflineDatabaseEntryBySource(sourceName string, sourceID string) (e
 		return
 	}
 
-	err = appendDetailsToAnimeOfflineDatabaseEntry(id, &entry)
+	entry.ID = id
+	entries := []AnimeOfflineDatabaseEntry{entry}
+	err = appendDetailsToAnimeOfflineDatabaseEntries(entries)
+	entry = entries[0]
 
 	return
 }
 
-func appendDetailsToAnimeOfflineDatabaseEntry(aid string, entry *AnimeOfflineDatabaseEntry) (err error) {
-	sourcesRows, err := db.Query(`
-		SELECT
-			anime_offline_database_sources.source_url
-		FROM
-			anime_offline_database_sources
-		WHERE
-			anime_offline_database_sources.anime_offline_database_id = ?
-	`, aid)
-
-	if err != nil {
+// Loads the sources, synonyms, relations, tags and score of the
+// entries with one query each, whatever the number of entries.
+func appendDetailsToAnimeOfflineDatabaseEntries(entries []AnimeOfflineDatabaseEntry) (err error) {
+	if len(entries) == 0 {
 		return
 	}
 
-	defer sourcesRows.Close()
-
-	for sourcesRows.Next() {
-		var source string
-		err = sourcesRows.Scan(&source)
-
-		if err != nil {
-			return
-		}
-
-		entry.Sources = append(entry.Sources, source)
-	}
-
-	err = sourcesRows.Err()
+	byID := make(map[string]*AnimeOfflineDatabaseEntry, len(entries))
+	ids := make([]string, len(entries))
 
-	if err != nil {
-		return
+	for i := range entries {
+		byID[entries[i].ID] = &entries[i]
+		ids[i] = entries[i].ID
 	}
 
-	synonymsRows, err := db.Query(`
-		SELECT
-			anime_offline_database_synonyms.synonym
-		FROM
-			anime_offline_database_synonyms
-		WHERE
-			anime_offline_database_synonyms.anime_offline_database_id = ?
-	`, aid)
-
-	if err != nil {
-		return
+	details := []struct {
+		table  string
+		column string
+		add    func(entry *AnimeOfflineDatabaseEntry, value string)
+	}{
+		{"anime_offline_database_sources", "source_url", func(entry *AnimeOfflineDatabaseEntry, value string) {
+			entry.Sources = append(entry.Sources, value)
+		}},
+		{"anime_offline_database_synonyms", "synonym", func(entry *AnimeOfflineDatabaseEntry, value string) {
+			entry.Synonyms = append(entry.Synonyms, value)
+		}},
+		{"anime_offline_database_relations", "relation", func(entry *AnimeOfflineDatabaseEntry, value string) {
+			entry.Relations = append(entry.Relations, value)
+		}},
+		{"anime_offline_database_tags", "tag", func(entry *AnimeOfflineDatabaseEntry, value string) {
+			entry.Tags = append(entry.Tags, value)
+		}},
 	}
 
-	defer synonymsRows.Close()
-
-	for synonymsRows.Next() {
-		var synonym string
-		err = synonymsRows.Scan(&synonym)
+	for _, detail := range details {
+		var rows *sql.Rows
+		rows, err = db.Query(fmt.Sprintf(`
+			SELECT
+				%[1]s.anime_offline_database_id,
+				%[1]s.%[2]s
+			FROM
+				%[1]s
+			WHERE
+				%[1]s.anime_offline_database_id IN (%[3]s)
+			ORDER BY
+				%[1]s.rowid
+		`, detail.table, detail.column, sqlPlaceholders(len(ids))), appendStringArgs(nil, ids)...)
 
 		if err != nil {
 			return
 		}
 
-		entry.Synonyms = append(entry.Synonyms, synonym)
-	}
-
-	err = synonymsRows.Err()
+		defer rows.Close()
 
-	if err != nil {
-		return
-	}
-
-	relationsRows, err := db.Query(`
-		SELECT
-			anime_offline_database_relations.relation
-		FROM
-			anime_offline_database_relations
-		WHERE
-			anime_offline_database_relations.anime_offline_database_id = ?
-	`, aid)
-
-	if err != nil {
-		return
-	}
+		for rows.Next() {
+			var id, value string
 
-	defer relationsRows.Close()
+			if err = rows.Scan(&id, &value); err != nil {
+				return
+			}
 
-	for relationsRows.Next() {
-		var relation string
-		err = relationsRows.Scan(&relation)
+			if entry, ok := byID[id]; ok {
+				detail.add(entry, value)
+			}
+		}
 
-		if err != nil {
+		if err = rows.Err(); err != nil {
 			return
 		}
 
-		entry.Relations = append(entry.Relations, relation)
-	}
-
-	err = relationsRows.Err()
-
-	if err != nil {
-		return
+		rows.Close()
 	}
 
-	tagsRows, err := db.Query(`
+	rows, err := db.Query(fmt.Sprintf(`
 		SELECT
-			anime_offline_database_tags.tag
+			anime_offline_database_scores.anime_offline_database_id,
+			anime_offline_database_scores.arithmetic_geometric_mean,
+			anime_offline_database_scores.arithmetic_mean,
+			anime_offline_database_scores.median
 		FROM
-			anime_offline_database_tags
+			anime_offline_database_scores
 		WHERE
-			anime_offline_database_tags.anime_offline_database_id = ?
-	`, aid)
+			anime_offline_database_scores.anime_offline_database_id IN (%s)
+	`, sqlPlaceholders(len(ids))), appendStringArgs(nil, ids)...)
 
 	if err != nil {
 		return
 	}
 
-	defer tagsRows.Close()
+	defer rows.Close()
 
-	for tagsRows.Next() {
-		var tag string
-		err = tagsRows.Scan(&tag)
+	for rows.Next() {
+		var id string
+		var score AnimeOfflineDatabaseScore
 
-		if err != nil {
+		if err = rows.Scan(&id, &score.ArithmeticGeometricMean, &score.ArithmeticMean, &score.Median); err != nil {
 			return
 		}
 
-		entry.Tags = append(entry.Tags, tag)
+		if entry, ok := byID[id]; ok {
+			entry.Score = &score
+		}
 	}
 
-	err = tagsRows.Err()
+	err = rows.Err()
 
 	return
 }
@@ -1536,9 +2341,15 @@ func GetVNDBVisualNovelByID(vnid string) (entry VNDBVisualNovelEntry, err error)
 		SELECT
 			vndb_visual_novels.vnid,
 			vndb_visual_novels.original_language,
-			vndb_visual_novels.image_id
+			vndb_visual_novels.image_id,
+			COALESCE(vndb_visual_novel_stats.vote_count, 0),
+			vndb_visual_novel_stats.rating
 		FROM
 			vndb_visual_novels
+		LEFT JOIN
+			vndb_visual_novel_stats
+		ON
+			vndb_visual_novel_stats.vnid = vndb_visual_novels.vnid
 		WHERE
 			vndb_visual_novels.vnid = ?
 	`, vnid)
@@ -1547,11 +2358,94 @@ func GetVNDBVisualNovelByID(vnid string) (entry VNDBVisualNovelEntry, err error)
 		&entry.ID,
 		&entry.OriginalLanguage,
 		&entry.ImageID,
+		&entry.VoteCount,
+		&entry.Rating,
 	)
 
 	return
 }
 
+func GetVNDBVisualNovelsByReleaseID(releaseID string) (entries []VNDBVisualNovelEntry, err error) {
+	return queryVNDBVisualNovels(`
+		SELECT
+			vndb_visual_novels.vnid,
+			vndb_visual_novels.original_language,
+			vndb_visual_novels.image_id,
+			COALESCE(vndb_visual_novel_stats.vote_count, 0),
+			vndb_visual_novel_stats.rating
+		FROM
+			vndb_visual_novels
+		LEFT JOIN
+			vndb_visual_novel_stats
+		ON
+			vndb_visual_novel_stats.vnid = vndb_visual_novels.vnid
+		WHERE
+			vndb_visual_novels.vnid IN (
+				SELECT vnid
+				FROM vndb_releases_visual_novels
+				WHERE release_id = ?
+			)
+		ORDER BY
+			CAST(SUBSTR(vndb_visual_novels.vnid, 2) AS INTEGER)
+	`, releaseID)
+}
+
+func GetVNDBVisualNovelsByCharacterID(characterID string) (entries []VNDBVisualNovelEntry, err error) {
+	return queryVNDBVisualNovels(`
+		SELECT
+			vndb_visual_novels.vnid,
+			vndb_visual_novels.original_language,
+			vndb_visual_novels.image_id,
+			COALESCE(vndb_visual_novel_stats.vote_count, 0),
+			vndb_visual_novel_stats.rating
+		FROM
+			vndb_visual_novels
+		LEFT JOIN
+			vndb_visual_novel_stats
+		ON
+			vndb_visual_novel_stats.vnid = vndb_visual_novels.vnid
+		WHERE
+			vndb_visual_novels.vnid IN (
+				SELECT vnid
+				FROM vndb_characters_visual_novels
+				WHERE character_id = ?
+			)
+		ORDER BY
+			CAST(SUBSTR(vndb_visual_novels.vnid, 2) AS INTEGER)
+	`, characterID)
+}
+
+func queryVNDBVisualNovels(querySQL string, args ...any) (entries []VNDBVisualNovelEntry, err error) {
+	rows, err := db.Query(querySQL, args...)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry VNDBVisualNovelEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.OriginalLanguage,
+			&entry.ImageID,
+			&entry.VoteCount,
+			&entry.Rating,
+		)
+
+		if err != nil {
+			return
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
 func GetVNDBTitleByID(id string) (entry VNDBTitleEntry, err error) {
 	row := db.QueryRow(`
 		SELECT
@@ -1669,101 +2563,3 @@ func GetVNDBImageInfoByID(id string) (entry VNDBImageEntry, err error) {
 
 	return
 }
-
-func searchVNDBTitleIndex(query string, limit int, idxTableName string) (entries []VNDBTitleEntry, err error) {
-	firstID, lastID, err := getLiveRangeOfTable("vndb_titles")
-
-	if err != nil {
-		return
-	}
-
-	querySQL := fmt.Sprintf(`
-		SELECT
-			vndb_titles.id,
-			vndb_titles.vnid,
-			vndb_titles.title,
-			vndb_titles.language,
-			vndb_titles.official,
-			vndb_titles.latin
-		FROM
-			vndb_titles
-		JOIN (
-			SELECT docid, rank(matchinfo(%s)) AS rank
-			FROM %s
-			WHERE title MATCH ?
-			AND docid BETWEEN ? AND ?
-			ORDER BY rank DESC
-			LIMIT ?
-		) AS matches ON matches.docid = vndb_titles.id
-	`, idxTableName, idxTableName)
-
-	rows, err := db.Query(querySQL, query, firstID, lastID, limit)
-
-	if err != nil {
-		return
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		var entry VNDBTitleEntry
-		err = rows.Scan(
-			&entry.ID,
-			&entry.VNID,
-			&entry.Title,
-			&entry.Language,
-			&entry.Official,
-			&entry.Latin,
-		)
-
-		if err != nil {
-			return
-		}
-
-		entries = append(entries, entry)
-	}
-
-	err = rows.Err()
-
-	return
-}
-
-func SearchVNDBJapaneseTitles(query string, limit int) ([]VNDBTitleEntry, error) {
-	return searchVNDBTitleIndex(query, limit, "vndb_titles_ja_fts_idx")
-}
-
-func SearchVNDBEnglishTitles(query string, limit int) ([]VNDBTitleEntry, error) {
-	return searchVNDBTitleIndex(query, limit, "vndb_titles_en_fts_idx")
-}
-
-func SearchVNDBTitles(query string, limit int) (entries []VNDBTitleEntry, err error) {
-	jaEntries, err := SearchVNDBJapaneseTitles(query, limit)
-
-	if err != nil {
-		return
-	}
-
-	entries = append(entries, jaEntries...)
-
-	if len(entries) >= limit {
-		return
-	}
-
-	enEntries, err := SearchVNDBEnglishTitles(query, limit)
-
-	if err != nil {
-		return
-	}
-
-	if len(entries) >= limit {
-		return
-	}
-
-	entries = append(entries, enEntries...)
-
-	if len(entries) >= limit {
-		entries = entries[:limit]
-	}
-
-	return
-}
@@ -90,6 +90,45 @@ func init() {
 				return
 			}, true)
 
+			if err != nil {
+				return
+			}
+
+			if err = conn.RegisterFunc("title_similarity", titleSimilarity, true); err != nil {
+				return
+			}
+
+			if err = conn.RegisterFunc("is_kana", IsKana, true); err != nil {
+				return
+			}
+
+			if err = conn.RegisterFunc("kana_to_romaji", KanaToRomaji, true); err != nil {
+				return
+			}
+
+			if err = conn.RegisterFunc("generated_romaji", generatedRomaji, true); err != nil {
+				return
+			}
+
+			if err = conn.RegisterFunc("normalize_romaji", NormalizeRomaji, true); err != nil {
+				return
+			}
+
+			if err = conn.RegisterFunc("title_acronyms", titleAcronymsJSON, true); err != nil {
+				return
+			}
+
+			err = conn.RegisterFunc("popularity", func(key int64, score float64, source string, titleType string, votes int, rating float64, sources int, meanScore float64) float64 {
+				return lookupPopularityFunc(key)(score, PopularitySignals{
+					Source:    source,
+					TitleType: titleType,
+					Votes:     votes,
+					Rating:    rating,
+					Sources:   sources,
+					Score:     meanScore,
+				})
+			}, true)
+
 			return
 		},
 	})
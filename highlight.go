@@ -0,0 +1,76 @@
+package otame
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Byte range of a title matched by a term of the query.
+type MatchSpan struct {
+	Start int
+	End   int
+}
+
+// Reads the spans of the value returned by the FTS offsets function, a list
+// of column, term, byte offset and size quadruples. Spans are sorted, and
+// overlapping or adjacent spans merged.
+func parseMatchOffsets(offsets string) (spans []MatchSpan) {
+	fields := strings.Fields(offsets)
+
+	for i := 0; i+3 < len(fields); i += 4 {
+		start, err := strconv.Atoi(fields[i+2])
+
+		if err != nil {
+			continue
+		}
+
+		size, err := strconv.Atoi(fields[i+3])
+
+		if err != nil {
+			continue
+		}
+
+		spans = append(spans, MatchSpan{start, start + size})
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start < spans[j].Start
+	})
+
+	merged := spans[:0]
+
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span.Start <= merged[n-1].End {
+			merged[n-1].End = max(merged[n-1].End, span.End)
+			continue
+		}
+
+		merged = append(merged, span)
+	}
+
+	return merged
+}
+
+// Wraps the spans of text in open and close. Spans out of range
+// of the text are ignored.
+func highlightSpans(text string, spans []MatchSpan, open string, close string) string {
+	var b strings.Builder
+	last := 0
+
+	for _, span := range spans {
+		if span.Start < last || span.End > len(text) || span.Start >= span.End {
+			continue
+		}
+
+		b.WriteString(text[last:span.Start])
+		b.WriteString(open)
+		b.WriteString(text[span.Start:span.End])
+		b.WriteString(close)
+		last = span.End
+	}
+
+	b.WriteString(text[last:])
+
+	return b.String()
+}
@@ -0,0 +1,114 @@
+package otame
+
+import (
+	"fmt"
+)
+
+// Max number of IDs bound in a single query, well below
+// SQLite's default limit on host parameters.
+const mapIDsChunkSize = 500
+
+// Returns the IDs every provider uses for the anime identified by id on
+// the from provider, including the from provider itself. An ID unknown
+// to anime offline database results in an empty map.
+func MapID(from Provider, id string) (ids map[Provider][]string, err error) {
+	mappings, err := MapIDs(from, []string{id})
+
+	if err != nil {
+		return
+	}
+
+	ids = mappings[id]
+
+	if ids == nil {
+		ids = make(map[Provider][]string)
+	}
+
+	return
+}
+
+// Same as MapID, but only returns the IDs of the to provider.
+func MapIDTo(from Provider, id string, to Provider) (ids []string, err error) {
+	mappings, err := MapID(from, id)
+
+	if err != nil {
+		return
+	}
+
+	ids = mappings[to]
+
+	return
+}
+
+// Batch version of MapID. The result is keyed by the input IDs,
+// and IDs without any mapping are left out.
+func MapIDs(from Provider, ids []string) (mappings map[string]map[Provider][]string, err error) {
+	mappings = make(map[string]map[Provider][]string)
+	ids = uniqueStrings(ids)
+
+	for start := 0; start < len(ids); start += mapIDsChunkSize {
+		end := min(start+mapIDsChunkSize, len(ids))
+
+		if err = mapIDChunk(from, ids[start:end], mappings); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func mapIDChunk(from Provider, ids []string, mappings map[string]map[Provider][]string) (err error) {
+	querySQL := fmt.Sprintf(`
+		SELECT DISTINCT
+			src.source_id,
+			dst.source_name,
+			dst.source_id
+		FROM
+			anime_offline_database_sources AS src
+		JOIN
+			anime_offline_database_sources AS dst
+		ON
+			dst.anime_offline_database_id = src.anime_offline_database_id
+		WHERE
+			src.source_name = ?
+		AND
+			src.source_id IN (%s)
+		AND
+			src.recognized
+		AND
+			dst.recognized
+		ORDER BY
+			src.source_id,
+			dst.source_name,
+			dst.source_id
+	`, sqlPlaceholders(len(ids)))
+
+	args := appendStringArgs([]any{string(from)}, ids)
+	rows, err := db.Query(querySQL, args...)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var fromID, toName, toID string
+		err = rows.Scan(&fromID, &toName, &toID)
+
+		if err != nil {
+			return
+		}
+
+		if mappings[fromID] == nil {
+			mappings[fromID] = make(map[Provider][]string)
+		}
+
+		to := Provider(toName)
+		mappings[fromID][to] = append(mappings[fromID][to], toID)
+	}
+
+	err = rows.Err()
+
+	return
+}
@@ -0,0 +1,72 @@
+package otame
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Lower-cases s and replaces everything but letters and digits with
+// single spaces, so titles differing only in punctuation compare equal.
+func normalizeTitle(s string) string {
+	var b strings.Builder
+	space := false
+
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+
+			b.WriteRune(r)
+			space = false
+		} else {
+			space = true
+		}
+	}
+
+	return b.String()
+}
+
+func titleBigrams(s string) map[string]int {
+	runes := []rune(strings.ReplaceAll(normalizeTitle(s), " ", ""))
+	bigrams := make(map[string]int)
+
+	if len(runes) == 1 {
+		bigrams[string(runes)]++
+	}
+
+	for i := 0; i+1 < len(runes); i++ {
+		bigrams[string(runes[i:i+2])]++
+	}
+
+	return bigrams
+}
+
+// Dice coefficient of the character bigrams of both normalized titles,
+// ranging from 0 for nothing in common to 1 for equal titles. Works the
+// same for scripts which do not separate words with spaces.
+func titleSimilarity(a string, b string) float64 {
+	aBigrams := titleBigrams(a)
+	bBigrams := titleBigrams(b)
+	total := 0
+
+	for _, n := range aBigrams {
+		total += n
+	}
+
+	for _, n := range bBigrams {
+		total += n
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	shared := 0
+
+	for bigram, n := range aBigrams {
+		shared += min(n, bBigrams[bigram])
+	}
+
+	return 2 * float64(shared) / float64(total)
+}
@@ -0,0 +1,202 @@
+package otame
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// Share of popularity in the score of searches with SearchOptions.Popularity
+// set, from 0 for text relevance only to 1 for a score proportional to
+// popularity, see DefaultPopularityFunc.
+var PopularityWeight = 0.2
+
+// Number of VNDB votes, or of anime offline database sources, from which
+// a visual novel or anime counts as fully popular. Counts below it are
+// compared on a log scale, so that the first votes matter the most.
+var (
+	PopularityVoteSaturation   = 1000
+	PopularitySourceSaturation = 8
+)
+
+// Multipliers applied to the score of matches of each AniDB title type in
+// searches with SearchOptions.Popularity set, so that the main title of an
+// anime wins over the synonyms and short titles of others.
+var PopularityTitleTypeWeights = map[string]float64{
+	AniDBEntryTypePrimary:  1,
+	AniDBEntryTypeOfficial: 0.95,
+	AniDBEntryTypeSynonym:  0.9,
+	AniDBEntryTypeShort:    0.85,
+}
+
+// Popularity signals of the anime or visual novel of a match.
+type PopularitySignals struct {
+	// One of the TitleSource* constants.
+	Source string
+	// AniDB type of the matched title, "" for other sources.
+	TitleType string
+	// VNDB vote count, and Bayesian rating from 1 to 10 or 0 if unknown.
+	Votes  int
+	Rating float64
+	// Number of sites the anime offline database links the anime to, and
+	// its score from 1 to 10 or 0 if unknown. AniDB matches take those of
+	// the entry of their aid.
+	Sources int
+	Score   float64
+}
+
+// Combines the text score of a match with the popularity of its anime or
+// visual novel into its final score.
+type PopularityFunc func(score float64, signals PopularitySignals) float64
+
+// Weights the score by title type, then scales it down by up to
+// PopularityWeight for unpopular matches, see PopularitySignals.Popularity.
+// Used by searches whose options have no PopularityFunc.
+var DefaultPopularityFunc PopularityFunc = func(score float64, signals PopularitySignals) float64 {
+	if weight, ok := PopularityTitleTypeWeights[signals.TitleType]; ok {
+		score *= weight
+	}
+
+	return score * (1 - PopularityWeight + PopularityWeight*signals.Popularity())
+}
+
+// Popularity from 0 to 1 of the anime or visual novel, the mean of the
+// vote or source count relative to its saturation and of the rating or
+// score, the latter left out when unknown. Used by DefaultPopularityFunc,
+// and available to other PopularityFunc implementations.
+func (signals PopularitySignals) Popularity() float64 {
+	count, saturation, rating := signals.Sources, PopularitySourceSaturation, signals.Score
+
+	if signals.Source == TitleSourceVNDB {
+		count, saturation, rating = signals.Votes, PopularityVoteSaturation, signals.Rating
+	}
+
+	popularity := min(1, math.Log1p(float64(count))/math.Log1p(float64(saturation)))
+
+	if rating > 0 {
+		popularity = (popularity + rating/10) / 2
+	}
+
+	return popularity
+}
+
+// Popularity functions of the searches being run, by the key the popularity
+// SQL function is given, see registerPopularityFunc.
+var (
+	popularityFuncs       sync.Map
+	lastPopularityFuncKey atomic.Int64
+)
+
+// Registers the popularity function of a search until the key it returns
+// is released with releasePopularityFunc. A nil function is not registered
+// and gets the key 0, which stands for DefaultPopularityFunc.
+func registerPopularityFunc(f PopularityFunc) (key int64) {
+	if f == nil {
+		return 0
+	}
+
+	key = lastPopularityFuncKey.Add(1)
+	popularityFuncs.Store(key, f)
+
+	return
+}
+
+func releasePopularityFunc(key int64) {
+	popularityFuncs.Delete(key)
+}
+
+// Popularity function registered with the key, or DefaultPopularityFunc.
+func lookupPopularityFunc(key int64) PopularityFunc {
+	if f, ok := popularityFuncs.Load(key); ok {
+		return f.(PopularityFunc)
+	}
+
+	return DefaultPopularityFunc
+}
+
+// Arguments of the popularity function after the score, giving the signals
+// of the rows of each content table. Literals are floats where the function
+// takes one, as integers are not converted.
+var popularitySignalsSQL = map[string]string{
+	"anidb_titles": fmt.Sprintf(`
+		'%[1]s',
+		anidb_titles.type,
+		0,
+		0.0,
+		(
+			SELECT COUNT(*)
+			FROM anime_offline_database_sources
+			JOIN anime_offline_database_sources AS anidb_sources
+			ON anidb_sources.anime_offline_database_id = anime_offline_database_sources.anime_offline_database_id
+			WHERE anidb_sources.source_name = '%[2]s'
+			AND anidb_sources.source_id = anidb_titles.aid
+			AND anidb_sources.recognized
+		),
+		COALESCE((
+			SELECT anime_offline_database_scores.arithmetic_geometric_mean
+			FROM anime_offline_database_scores
+			JOIN anime_offline_database_sources AS anidb_sources
+			ON anidb_sources.anime_offline_database_id = anime_offline_database_scores.anime_offline_database_id
+			WHERE anidb_sources.source_name = '%[2]s'
+			AND anidb_sources.source_id = anidb_titles.aid
+			AND anidb_sources.recognized
+		), 0.0)
+	`, TitleSourceAniDB, ProviderAniDB),
+	"vndb_titles": fmt.Sprintf(`
+		'%s',
+		'',
+		COALESCE((SELECT vote_count FROM vndb_visual_novel_stats WHERE vnid = vndb_titles.vnid), 0),
+		COALESCE((SELECT rating / 100.0 FROM vndb_visual_novel_stats WHERE vnid = vndb_titles.vnid), 0.0),
+		0,
+		0.0
+	`, TitleSourceVNDB),
+	"anime_offline_database": fmt.Sprintf(`
+		'%s',
+		'',
+		0,
+		0.0,
+		(
+			SELECT COUNT(*)
+			FROM anime_offline_database_sources
+			WHERE anime_offline_database_id = anime_offline_database.id
+		),
+		COALESCE((
+			SELECT arithmetic_geometric_mean
+			FROM anime_offline_database_scores
+			WHERE anime_offline_database_id = anime_offline_database.id
+		), 0.0)
+	`, TitleSourceAnimeOfflineDatabase),
+}
+
+// Signals of AniDB titles when the anime offline database tables are
+// missing, leaving only their title type.
+var aniDBTitleTypePopularitySignalsSQL = fmt.Sprintf(`'%s', anidb_titles.type, 0, 0.0, 0, 0.0`, TitleSourceAniDB)
+
+// Arguments of the popularity function for rows of the content table, see
+// popularitySignalsSQL, without the anime offline database signals of AniDB
+// titles if its tables have not been created.
+func popularitySignalsOf(table string) (signals string, err error) {
+	if table != "anidb_titles" {
+		return popularitySignalsSQL[table], nil
+	}
+
+	missing, err := missingTables("anime_offline_database_sources", "anime_offline_database_scores")
+
+	if err != nil {
+		return
+	}
+
+	if len(missing) > 0 {
+		return aniDBTitleTypePopularitySignalsSQL, nil
+	}
+
+	return popularitySignalsSQL[table], nil
+}
+
+// Wraps a score expression with the popularity function, given the signals
+// of the row, see popularitySignalsOf. The key of the function, see
+// registerPopularityFunc, is the argument preceding those of the score.
+func popularitySQL(signals string, score string) string {
+	return fmt.Sprintf("popularity(?, %s, %s)", score, signals)
+}
@@ -0,0 +1,441 @@
+package otame
+
+import (
+	"errors"
+	"fmt"
+	nurl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Name of a site that anime offline database links to, as stored
+// in the source_name column of anime_offline_database_sources.
+type Provider string
+
+const (
+	ProviderAniDB            Provider = "anidb.net"
+	ProviderAniList          Provider = "anilist.co"
+	ProviderAnimePlanet      Provider = "anime-planet.com"
+	ProviderAniSearch        Provider = "anisearch.com"
+	ProviderAnimeNewsNetwork Provider = "animenewsnetwork.com"
+	ProviderKitsu            Provider = "kitsu.io"
+	ProviderLiveChart        Provider = "livechart.me"
+	ProviderMyAnimeList      Provider = "myanimelist.net"
+	ProviderNotifyMoe        Provider = "notify.moe"
+	ProviderSimkl            Provider = "simkl.com"
+)
+
+// Not an anime offline database source, but registered as a visual novel
+// provider so that VNDB URLs can be parsed alongside the anime providers.
+// Its IDs keep their type prefix, such as "v17" for a visual novel or
+// "r123" for a release.
+const ProviderVNDB Provider = "vndb.org"
+
+// Every provider known to appear in anime offline database sources.
+var AnimeOfflineDatabaseProviders = []Provider{
+	ProviderAniDB,
+	ProviderAniList,
+	ProviderAnimePlanet,
+	ProviderAniSearch,
+	ProviderAnimeNewsNetwork,
+	ProviderKitsu,
+	ProviderLiveChart,
+	ProviderMyAnimeList,
+	ProviderNotifyMoe,
+	ProviderSimkl,
+}
+
+var ErrUnrecognizedURL = errors.New("unrecognized provider url")
+
+type providerURLFormat struct {
+	provider Provider
+	// Normalized hostnames (see NormalizeProviderName) the provider is served from.
+	hosts   []string
+	parseID func(url *nurl.URL) (id string, ok bool)
+	buildID func(id string) string
+}
+
+// URL formats of providers by provider and by normalized hostname.
+type providerRegistry struct {
+	lock    sync.RWMutex
+	formats map[Provider]providerURLFormat
+	byHost  map[string]providerURLFormat
+}
+
+func newProviderRegistry() *providerRegistry {
+	return &providerRegistry{
+		formats: make(map[Provider]providerURLFormat),
+		byHost:  make(map[string]providerURLFormat),
+	}
+}
+
+// Registries of RegisterProvider and RegisterVisualNovelProvider. Only the
+// former is used to recognize anime offline database sources.
+var (
+	animeProviders       = newProviderRegistry()
+	visualNovelProviders = newProviderRegistry()
+)
+
+// Adds an anime provider to the URL registry used by ParseProviderURL,
+// ProviderURL and ParseAnimeOfflineDatabaseSource, replacing any previous
+// registration of the same provider or hosts. parseID reports whether
+// the URL is one of the provider's anime pages and returns its ID,
+// buildID returns the canonical URL of an ID.
+func RegisterProvider(
+	provider Provider,
+	hosts []string,
+	parseID func(url *nurl.URL) (id string, ok bool),
+	buildID func(id string) string,
+) {
+	animeProviders.register(providerURLFormat{provider, hosts, parseID, buildID})
+}
+
+// Same as RegisterProvider, for providers of visual novels, whose URLs are
+// parsed by ParseProviderURL but are not anime offline database sources.
+func RegisterVisualNovelProvider(
+	provider Provider,
+	hosts []string,
+	parseID func(url *nurl.URL) (id string, ok bool),
+	buildID func(id string) string,
+) {
+	visualNovelProviders.register(providerURLFormat{provider, hosts, parseID, buildID})
+}
+
+func (r *providerRegistry) register(format providerURLFormat) {
+	provider := format.provider
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// hosts of a previous registration the new one does not serve
+	if previous, ok := r.formats[provider]; ok {
+		for _, host := range previous.hosts {
+			host = string(NormalizeProviderName(host))
+
+			if current, ok := r.byHost[host]; ok && current.provider == provider {
+				delete(r.byHost, host)
+			}
+		}
+	}
+
+	for _, host := range format.hosts {
+		host = string(NormalizeProviderName(host))
+
+		// providers losing the host to this one no longer serve it
+		if current, ok := r.byHost[host]; ok && current.provider != provider {
+			other := r.formats[current.provider]
+			other.hosts = removeProviderHost(other.hosts, host)
+			r.formats[current.provider] = other
+		}
+
+		r.byHost[host] = format
+	}
+
+	r.formats[provider] = format
+}
+
+func (r *providerRegistry) formatOfHost(host string) (format providerURLFormat, ok bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	format, ok = r.byHost[string(NormalizeProviderName(host))]
+
+	return
+}
+
+func (r *providerRegistry) format(provider Provider) (format providerURLFormat, ok bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	format, ok = r.formats[provider]
+
+	return
+}
+
+func removeProviderHost(hosts []string, host string) (remaining []string) {
+	for _, h := range hosts {
+		if string(NormalizeProviderName(h)) != host {
+			remaining = append(remaining, h)
+		}
+	}
+
+	return
+}
+
+// Lower-cases a hostname and strips its "www." prefix.
+func NormalizeProviderName(host string) Provider {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	host = strings.TrimPrefix(host, "www.")
+
+	return Provider(host)
+}
+
+// Returns the provider and ID of an anime or visual novel page URL, or
+// ErrUnrecognizedURL if no registered provider accepts it.
+func ParseProviderURL(rawURL string) (provider Provider, id string, err error) {
+	return parseProviderURL(rawURL, animeProviders, visualNovelProviders)
+}
+
+// Same as ParseProviderURL, only accepting URLs of anime providers.
+func parseAnimeProviderURL(rawURL string) (provider Provider, id string, err error) {
+	return parseProviderURL(rawURL, animeProviders)
+}
+
+// Parses the URL with the provider of its host in the first registry
+// having one.
+func parseProviderURL(rawURL string, registries ...*providerRegistry) (provider Provider, id string, err error) {
+	url, err := nurl.Parse(strings.TrimSpace(rawURL))
+
+	if err != nil {
+		return
+	}
+
+	for _, registry := range registries {
+		format, ok := registry.formatOfHost(url.Hostname())
+
+		if !ok {
+			continue
+		}
+
+		parsedID, ok := format.parseID(url)
+
+		if !ok {
+			break
+		}
+
+		provider = format.provider
+		id = parsedID
+
+		return
+	}
+
+	err = fmt.Errorf("%w: %s", ErrUnrecognizedURL, rawURL)
+
+	return
+}
+
+// Returns the canonical page URL of id on the provider.
+func ProviderURL(provider Provider, id string) (url string, err error) {
+	for _, registry := range []*providerRegistry{animeProviders, visualNovelProviders} {
+		if format, ok := registry.format(provider); ok {
+			url = format.buildID(id)
+			return
+		}
+	}
+
+	err = fmt.Errorf("unknown provider: %s", provider)
+
+	return
+}
+
+type AnimeOfflineDatabaseSource struct {
+	Provider Provider
+	ID       string
+	URL      string
+	// False if no registered anime provider recognized the URL, in which case
+	// Provider is the normalized hostname and ID the path and query, such
+	// as "anime.php?id=1", so that different URLs keep different IDs.
+	Recognized bool
+}
+
+func ParseAnimeOfflineDatabaseSource(rawURL string) (source AnimeOfflineDatabaseSource, err error) {
+	source.URL = rawURL
+	source.Provider, source.ID, err = parseAnimeProviderURL(rawURL)
+
+	if err == nil {
+		source.Recognized = true
+		return
+	}
+
+	if !errors.Is(err, ErrUnrecognizedURL) {
+		return
+	}
+
+	url, err := nurl.Parse(strings.TrimSpace(rawURL))
+
+	if err != nil {
+		return
+	}
+
+	source.Provider = NormalizeProviderName(url.Hostname())
+	source.ID = strings.Join(urlPathSegments(url), "/")
+
+	if url.RawQuery != "" {
+		source.ID += "?" + url.RawQuery
+	}
+
+	return
+}
+
+// Path segments of the URL, without empty segments
+// left by repeated or trailing slashes.
+func urlPathSegments(url *nurl.URL) (segments []string) {
+	for _, segment := range strings.Split(url.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return
+}
+
+func isNumericID(id string) bool {
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil
+}
+
+// Parses URLs of the form /anime/<id>[/<slug>...].
+func animePathIDParser(numeric bool) func(url *nurl.URL) (string, bool) {
+	return func(url *nurl.URL) (id string, ok bool) {
+		segments := urlPathSegments(url)
+
+		if len(segments) < 2 || segments[0] != "anime" {
+			return
+		}
+
+		id = segments[1]
+		ok = !numeric || isNumericID(id)
+
+		return
+	}
+}
+
+// Parses URLs with the ID in a query parameter, such as /anime.php?id=<id>.
+func queryIDParser(path string, param string) func(url *nurl.URL) (string, bool) {
+	return func(url *nurl.URL) (id string, ok bool) {
+		if strings.TrimSuffix(url.Path, "/") != path {
+			return
+		}
+
+		id = url.Query().Get(param)
+		ok = isNumericID(id)
+
+		return
+	}
+}
+
+func firstIDParser(parsers ...func(url *nurl.URL) (string, bool)) func(url *nurl.URL) (string, bool) {
+	return func(url *nurl.URL) (id string, ok bool) {
+		for _, parse := range parsers {
+			if id, ok = parse(url); ok {
+				return
+			}
+		}
+
+		return
+	}
+}
+
+func urlBuilder(format string) func(id string) string {
+	return func(id string) string {
+		return fmt.Sprintf(format, nurl.PathEscape(id))
+	}
+}
+
+func init() {
+	RegisterProvider(
+		ProviderAniDB,
+		[]string{"anidb.net"},
+		firstIDParser(
+			animePathIDParser(true),
+			queryIDParser("/perl-bin/animedb.pl", "aid"),
+		),
+		urlBuilder("https://anidb.net/anime/%s"),
+	)
+
+	RegisterProvider(
+		ProviderAniList,
+		[]string{"anilist.co"},
+		animePathIDParser(true),
+		urlBuilder("https://anilist.co/anime/%s"),
+	)
+
+	RegisterProvider(
+		ProviderAnimePlanet,
+		[]string{"anime-planet.com"},
+		animePathIDParser(false),
+		urlBuilder("https://anime-planet.com/anime/%s"),
+	)
+
+	// aniSearch appends the slug to the ID after a comma: /anime/1572,cowboy-bebop
+	RegisterProvider(
+		ProviderAniSearch,
+		[]string{"anisearch.com", "anisearch.de"},
+		func(url *nurl.URL) (id string, ok bool) {
+			if id, ok = animePathIDParser(false)(url); !ok {
+				return
+			}
+
+			id, _, _ = strings.Cut(id, ",")
+			ok = isNumericID(id)
+
+			return
+		},
+		urlBuilder("https://anisearch.com/anime/%s"),
+	)
+
+	RegisterProvider(
+		ProviderAnimeNewsNetwork,
+		[]string{"animenewsnetwork.com"},
+		queryIDParser("/encyclopedia/anime.php", "id"),
+		urlBuilder("https://www.animenewsnetwork.com/encyclopedia/anime.php?id=%s"),
+	)
+
+	RegisterProvider(
+		ProviderKitsu,
+		[]string{"kitsu.io", "kitsu.app"},
+		animePathIDParser(false),
+		urlBuilder("https://kitsu.app/anime/%s"),
+	)
+
+	RegisterProvider(
+		ProviderLiveChart,
+		[]string{"livechart.me"},
+		animePathIDParser(true),
+		urlBuilder("https://livechart.me/anime/%s"),
+	)
+
+	RegisterProvider(
+		ProviderMyAnimeList,
+		[]string{"myanimelist.net"},
+		firstIDParser(
+			animePathIDParser(true),
+			queryIDParser("/anime.php", "id"),
+		),
+		urlBuilder("https://myanimelist.net/anime/%s"),
+	)
+
+	RegisterProvider(
+		ProviderNotifyMoe,
+		[]string{"notify.moe"},
+		animePathIDParser(false),
+		urlBuilder("https://notify.moe/anime/%s"),
+	)
+
+	RegisterProvider(
+		ProviderSimkl,
+		[]string{"simkl.com"},
+		animePathIDParser(true),
+		urlBuilder("https://simkl.com/anime/%s"),
+	)
+
+	// /v17, /r123 and /c456, optionally followed by a tab such as /v17/chars
+	RegisterVisualNovelProvider(
+		ProviderVNDB,
+		[]string{"vndb.org"},
+		func(url *nurl.URL) (id string, ok bool) {
+			segments := urlPathSegments(url)
+
+			if len(segments) == 0 || len(segments[0]) < 2 {
+				return
+			}
+
+			id = segments[0]
+			ok = strings.ContainsRune("vrc", rune(id[0])) && isNumericID(id[1:])
+
+			return
+		},
+		urlBuilder("https://vndb.org/%s"),
+	)
+}
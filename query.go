@@ -0,0 +1,218 @@
+package otame
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type SearchMode int
+
+const (
+	// Every word of the query must match. Punctuation and FTS operators
+	// are taken literally, so any user input is a valid query.
+	SearchModeSimple SearchMode = iota
+	// Same as SearchModeSimple, but the last word also matches as a
+	// prefix, for searching while typing.
+	SearchModePrefix
+	// The query is passed to FTS as is, allowing operators such as
+	// OR, NOT, NEAR, "phrases" and prefix* queries.
+	SearchModeAdvanced
+)
+
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// Returned for queries which can not be searched, such as empty
+// queries or advanced queries with syntax errors.
+// errors.Is(err, ErrInvalidQuery) reports whether an error is one.
+type InvalidQueryError struct {
+	Query  string
+	Reason string
+}
+
+func (e *InvalidQueryError) Error() string {
+	return fmt.Sprintf("%s %q: %s", ErrInvalidQuery, e.Query, e.Reason)
+}
+
+func (e *InvalidQueryError) Is(target error) bool {
+	return target == ErrInvalidQuery
+}
+
+// Wraps FTS syntax errors of a query in an InvalidQueryError.
+func wrapMatchError(query string, err error) error {
+	if err != nil && strings.Contains(err.Error(), "malformed MATCH expression") {
+		return &InvalidQueryError{Query: query, Reason: err.Error()}
+	}
+
+	return err
+}
+
+// Splits free text into words quoted as FTS phrases. Punctuation within a
+// word is left to the tokenizer, so "Re:Zero" matches the phrase "re zero".
+// Words without any letter or digit are dropped.
+func matchQueryWords(text string) (words []string) {
+	text = strings.NewReplacer(`"`, " ", "*", " ").Replace(text)
+
+	for _, word := range strings.Fields(text) {
+		if normalizeTitle(word) != "" {
+			words = append(words, `"`+word+`"`)
+		}
+	}
+
+	return
+}
+
+// Turns a query into a MATCH expression according to mode.
+func BuildMatchQuery(text string, mode SearchMode) (match string, err error) {
+	if mode == SearchModeAdvanced {
+		match = strings.TrimSpace(text)
+		err = validateAdvancedQuery(match)
+		return
+	}
+
+	words := matchQueryWords(text)
+
+	if len(words) == 0 {
+		err = &InvalidQueryError{Query: text, Reason: "no words to search for"}
+		return
+	}
+
+	// prefixes within phrases are unreliable with the ICU tokenizer,
+	// so the last word is split into its tokens, which are safe unquoted
+	if mode == SearchModePrefix {
+		last := strings.Fields(normalizeTitle(words[len(words)-1]))
+		words = words[:len(words)-1]
+
+		for _, token := range last[:len(last)-1] {
+			words = append(words, `"`+token+`"`)
+		}
+
+		words = append(words, last[len(last)-1]+"*")
+	}
+
+	match = strings.Join(words, " ")
+
+	return
+}
+
+// Builds a MATCH expression matching any word of the text.
+func anyWordMatchQuery(text string) string {
+	return strings.Join(matchQueryWords(text), " OR ")
+}
+
+// Catches the syntax errors FTS would report, with a clearer reason.
+func validateAdvancedQuery(query string) error {
+	if query == "" {
+		return &InvalidQueryError{Query: query, Reason: "empty query"}
+	}
+
+	if strings.Count(query, `"`)%2 != 0 {
+		return &InvalidQueryError{Query: query, Reason: "unterminated phrase"}
+	}
+
+	depth := 0
+	inPhrase := false
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			inPhrase = !inPhrase
+		case inPhrase:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		}
+
+		if depth < 0 {
+			return &InvalidQueryError{Query: query, Reason: "unbalanced parentheses"}
+		}
+	}
+
+	if depth != 0 {
+		return &InvalidQueryError{Query: query, Reason: "unbalanced parentheses"}
+	}
+
+	return nil
+}
+
+// Builds the route of every index to search. If route is set, each index
+// only receives the part of the query written in its script, see routeQuery.
+// Advanced queries are sent whole to the indexes of the scripts they contain.
+// Queries of indexes of normalized romaji are normalized alike, see
+// expandRomajiPrefixes for their prefix terms, and indexes also holding
+// titles without spaces are searched with the query so written as well.
+// Acronym indexes are only searched with queries that look like an
+// acronym. Routes whose part of the query has no words are left out, and
+// an InvalidQueryError is returned if none is left, or if an advanced
+// query is invalid for any.
+func buildTitleIndexRoutes(query string, mode SearchMode, indexes []titleIndex, route bool) (routes []titleIndexRoute, err error) {
+	if mode == SearchModeAdvanced {
+		if err = validateAdvancedQuery(strings.TrimSpace(query)); err != nil {
+			return
+		}
+	}
+
+	candidates := unroutedQuery(query, indexes)
+
+	if route {
+		candidates = routeQuery(query, indexes)
+	}
+
+	for _, candidate := range candidates {
+		if mode == SearchModeAdvanced {
+			candidate.query = query
+		}
+
+		if candidate.acronym {
+			if mode != SearchModeAdvanced && isAcronymQuery(candidate.query) {
+				candidate.match = strings.ToLower(strings.TrimSpace(candidate.query))
+				routes = append(routes, candidate)
+			}
+
+			continue
+		}
+
+		written := candidate.query
+
+		if candidate.normalized {
+			candidate.query = normalizeRomajiQuery(candidate.query, mode)
+		}
+
+		var matchErr error
+
+		if candidate.match, matchErr = BuildMatchQuery(candidate.query, mode); matchErr != nil {
+			if mode == SearchModeAdvanced {
+				return nil, matchErr
+			}
+
+			if err == nil {
+				err = matchErr
+			}
+
+			continue
+		}
+
+		if candidate.normalized && mode != SearchModeSimple {
+			candidate.match = expandRomajiPrefixes(candidate.match)
+		}
+
+		if words := strings.Fields(normalizeTitle(written)); candidate.spaceless && mode != SearchModeAdvanced && len(words) > 1 {
+			joined := strings.Join(words, "")
+
+			if mode == SearchModePrefix {
+				candidate.match = fmt.Sprintf("(%s) OR %s*", candidate.match, normalizeRomajiPrefix(joined))
+			} else {
+				candidate.match = fmt.Sprintf("(%s) OR %s", candidate.match, NormalizeRomaji(joined))
+			}
+		}
+
+		routes = append(routes, candidate)
+	}
+
+	if len(routes) > 0 {
+		err = nil
+	}
+
+	return
+}
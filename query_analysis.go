@@ -0,0 +1,117 @@
+package otame
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	ScriptLatin = "latin"
+	// Kana and kanji.
+	ScriptJapanese = "japanese"
+	// Letters of any other script, such as Hangul or Cyrillic.
+	ScriptOther = "other"
+)
+
+type QueryAnalysis struct {
+	// Scripts of the letters in the query, in order of first appearance.
+	Scripts []string
+	// Query text per script, with the letters of other scripts
+	// replaced by spaces. Digits and punctuation are kept in every segment.
+	Segments map[string]string
+}
+
+func (a QueryAnalysis) HasScript(script string) bool {
+	_, ok := a.Segments[script]
+	return ok
+}
+
+// Script of a rune, or "" for digits, punctuation and spaces.
+func runeScript(r rune) string {
+	switch {
+	case unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Han):
+		return ScriptJapanese
+	// prolonged sound mark and iteration marks are not assigned to a script
+	case r == 'ー' || r == '々' || r == 'ゝ' || r == 'ゞ' || r == 'ヽ' || r == 'ヾ':
+		return ScriptJapanese
+	case unicode.Is(unicode.Latin, r):
+		return ScriptLatin
+	case unicode.IsLetter(r):
+		return ScriptOther
+	}
+
+	return ""
+}
+
+// Detects the scripts a query is written in and splits it by script.
+func AnalyzeQuery(query string) (analysis QueryAnalysis) {
+	analysis.Segments = make(map[string]string)
+
+	for _, r := range query {
+		if script := runeScript(r); script != "" && !analysis.HasScript(script) {
+			analysis.Scripts = append(analysis.Scripts, script)
+			analysis.Segments[script] = ""
+		}
+	}
+
+	for _, script := range analysis.Scripts {
+		segment := strings.Map(func(r rune) rune {
+			if s := runeScript(r); s != "" && s != script {
+				return ' '
+			}
+
+			return r
+		}, query)
+
+		analysis.Segments[script] = strings.Join(strings.Fields(segment), " ")
+	}
+
+	return
+}
+
+// An index paired with the query it should run.
+type titleIndexRoute struct {
+	titleIndex
+	// Text matched titles are compared to.
+	query string
+	// MATCH expression built from query, see buildTitleIndexRoutes.
+	match string
+}
+
+// Sends the part of the query written in each of an index's scripts to that
+// index, as a route of its own, leaving out indexes none of whose scripts
+// appear in the query. An index only has a script if none of its titles can
+// be written in another one. Indexes without a script, and every index if
+// the query has no letters or letters of other scripts, receive the whole
+// query.
+func routeQuery(query string, indexes []titleIndex) (routes []titleIndexRoute) {
+	analysis := AnalyzeQuery(query)
+
+	if len(analysis.Scripts) == 0 || analysis.HasScript(ScriptOther) {
+		return unroutedQuery(query, indexes)
+	}
+
+	for _, index := range indexes {
+		if len(index.scripts) == 0 {
+			routes = append(routes, titleIndexRoute{titleIndex: index, query: query})
+			continue
+		}
+
+		for _, script := range index.scripts {
+			if segment, ok := analysis.Segments[script]; ok {
+				routes = append(routes, titleIndexRoute{titleIndex: index, query: segment})
+			}
+		}
+	}
+
+	return
+}
+
+// Sends the whole query to every index.
+func unroutedQuery(query string, indexes []titleIndex) (routes []titleIndexRoute) {
+	for _, index := range indexes {
+		routes = append(routes, titleIndexRoute{titleIndex: index, query: query})
+	}
+
+	return
+}
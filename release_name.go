@@ -0,0 +1,258 @@
+package otame
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fields parsed from a release filename such as
+// "[SubsPlease] Sousou no Frieren - 12 (1080p) [ABCD1234].mkv".
+// Fields not found in the name are left empty.
+type ReleaseName struct {
+	Group string
+	// Title with the group, tags, episode and season markers removed.
+	Title      string
+	Episode    *int
+	Version    *int
+	Season     *int
+	Resolution string
+	CRC        string
+	Extension  string
+}
+
+var (
+	releaseExtensionRegex   = regexp.MustCompile(`(?i)\.(mkv|mp4|avi|m4v|webm|ts|ogm|wmv|flv|mov)$`)
+	releaseGroupRegex       = regexp.MustCompile(`^\s*\[([^\]]+)\]`)
+	releaseTagRegex         = regexp.MustCompile(`[\[\(\{]([^\]\)\}]*)[\]\)\}]`)
+	releaseCRCRegex         = regexp.MustCompile(`^[0-9A-Fa-f]{8}$`)
+	releaseResolutionRegex  = regexp.MustCompile(`(?i)\b(\d{3,4}p|\d{3,4}x\d{3,4}|4k)\b`)
+	releaseSeasonEpRegex    = regexp.MustCompile(`(?i)\bS(\d{1,2})\s*E(\d{1,4})(?:v(\d))?\b`)
+	releaseDashEpisodeRegex = regexp.MustCompile(`\s-\s+(\d{1,4})(?:v(\d))?(?:\s|$)`)
+	releaseEpisodeRegex     = regexp.MustCompile(`(?i)\b(?:episode|ep|e)\.?\s*(\d{1,4})(?:v(\d))?\b`)
+	releaseSeasonRegex      = regexp.MustCompile(`(?i)\b(?:season\s*|s)(\d{1,2})\b`)
+	releaseOrdinalSeason    = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)\s+season\b`)
+)
+
+func atoiPtr(s string) *int {
+	if s == "" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(s)
+
+	if err != nil {
+		return nil
+	}
+
+	return &n
+}
+
+func ParseReleaseName(name string) (release ReleaseName) {
+	name = strings.TrimSpace(name)
+
+	if match := releaseExtensionRegex.FindStringSubmatch(name); match != nil {
+		release.Extension = strings.ToLower(match[1])
+		name = name[:len(name)-len(match[0])]
+	}
+
+	if match := releaseGroupRegex.FindStringSubmatch(name); match != nil {
+		release.Group = strings.TrimSpace(match[1])
+		name = name[len(match[0]):]
+	}
+
+	for _, match := range releaseTagRegex.FindAllStringSubmatch(name, -1) {
+		for _, tag := range strings.FieldsFunc(match[1], func(r rune) bool { return r == ' ' || r == ',' }) {
+			// digits alone are more likely a date, such as "[20240101]"
+			if releaseCRCRegex.MatchString(tag) && strings.ContainsAny(tag, "abcdefABCDEF") {
+				release.CRC = strings.ToUpper(tag)
+			} else if release.Resolution == "" && releaseResolutionRegex.MatchString(tag) {
+				release.Resolution = strings.ToLower(tag)
+			}
+		}
+	}
+
+	name = releaseTagRegex.ReplaceAllString(name, " ")
+
+	// names without spaces use underscores or dots as separators
+	if !strings.Contains(name, " ") {
+		name = strings.NewReplacer("_", " ", ".", " ").Replace(name)
+	} else {
+		name = strings.ReplaceAll(name, "_", " ")
+	}
+
+	if match := releaseResolutionRegex.FindStringSubmatchIndex(name); match != nil {
+		if release.Resolution == "" {
+			release.Resolution = strings.ToLower(name[match[2]:match[3]])
+		}
+
+		name = name[:match[0]] + " " + name[match[1]:]
+	}
+
+	// everything after the episode number is an episode title or tags
+	if match := releaseSeasonEpRegex.FindStringSubmatchIndex(name); match != nil {
+		release.Season = atoiPtr(name[match[2]:match[3]])
+		release.Episode = atoiPtr(name[match[4]:match[5]])
+		release.Version = atoiPtr(submatch(name, match, 3))
+		name = name[:match[0]]
+	} else if match := releaseDashEpisodeRegex.FindStringSubmatchIndex(name); match != nil {
+		release.Episode = atoiPtr(name[match[2]:match[3]])
+		release.Version = atoiPtr(submatch(name, match, 2))
+		name = name[:match[0]]
+	} else if match := releaseEpisodeRegex.FindStringSubmatchIndex(name); match != nil {
+		release.Episode = atoiPtr(name[match[2]:match[3]])
+		release.Version = atoiPtr(submatch(name, match, 2))
+		name = name[:match[0]]
+	}
+
+	for _, regex := range []*regexp.Regexp{releaseOrdinalSeason, releaseSeasonRegex} {
+		if match := regex.FindStringSubmatchIndex(name); match != nil {
+			if release.Season == nil {
+				release.Season = atoiPtr(name[match[2]:match[3]])
+			}
+
+			name = name[:match[0]] + " " + name[match[1]:]
+		}
+	}
+
+	release.Title = strings.Trim(strings.Join(strings.Fields(name), " "), " -_.")
+
+	return
+}
+
+// Returns the text of the nth submatch of an index match, or "" if it did not participate.
+func submatch(s string, match []int, n int) string {
+	if match[2*n] < 0 {
+		return ""
+	}
+
+	return s[match[2*n]:match[2*n+1]]
+}
+
+type ReleaseNameCandidate struct {
+	AID string
+	// The AniDB title or AODB title/synonym that matched best.
+	Title string
+	// Similarity of Title to the parsed release title, weighted by
+	// how well their sequel markers agree, from 0 to 1.
+	Score float64
+}
+
+type ReleaseNameMatch struct {
+	Release ReleaseName
+	// Best candidate, only valid if Found is true.
+	ReleaseNameCandidate
+	Found bool
+	// Equal to the best candidate's score.
+	Confidence   float64
+	Alternatives []ReleaseNameCandidate
+}
+
+// Parses a release filename and resolves its title to an AniDB anime using
+// the AniDB titles and anime offline database synonyms. Candidates are scored
+// by title similarity, preferring those of the season of the release, and up
+// to limit of them are considered.
+func ResolveReleaseName(name string, limit int) (match ReleaseNameMatch, err error) {
+	match.Release = ParseReleaseName(name)
+
+	if normalizeTitle(match.Release.Title) == "" {
+		return
+	}
+
+	base, marker := ParseSequelMarker(match.Release.Title)
+
+	if match.Release.Season != nil {
+		marker.Season = *match.Release.Season
+	}
+
+	candidates := make(map[string]ReleaseNameCandidate)
+	addCandidate := func(aid string, title string) {
+		score := sequelTitleSimilarity(base, marker, title)
+
+		if current, ok := candidates[aid]; !ok || score > current.Score {
+			candidates[aid] = ReleaseNameCandidate{AID: aid, Title: title, Score: score}
+		}
+	}
+
+	// markers are kept in the search, as they are often part of the title,
+	// such as in "Final Fantasy VII", and only used to score candidates
+	entries, err := SearchAniDBTitlesWithOptions(match.Release.Title, SearchOptions{Limit: limit})
+
+	if err != nil {
+		return
+	}
+
+	// fall back to any word matching, titles in filenames are often abbreviated
+	if len(entries) == 0 {
+		entries, err = SearchAniDBTitlesWithOptions(anyWordMatchQuery(match.Release.Title), SearchOptions{
+			Limit: limit,
+			Mode:  SearchModeAdvanced,
+		})
+
+		if err != nil {
+			return
+		}
+	}
+
+	for _, entry := range entries {
+		switch {
+		case entry.GeneratedRomaji != "":
+			addCandidate(entry.AID, entry.GeneratedRomaji)
+		case entry.Alias != "":
+			addCandidate(entry.AID, entry.Alias)
+		default:
+			addCandidate(entry.AID, entry.Title)
+		}
+	}
+
+	aodbEntries, err := FilterAnimeOfflineDatabaseEntries(AnimeOfflineDatabaseFilter{
+		Title: match.Release.Title,
+		Limit: limit,
+	})
+
+	if err != nil {
+		return
+	}
+
+	for _, entry := range aodbEntries {
+		for _, source := range entry.Sources {
+			provider, aid, parseErr := ParseProviderURL(source)
+
+			if parseErr != nil || provider != ProviderAniDB {
+				continue
+			}
+
+			addCandidate(aid, entry.Title)
+
+			for _, synonym := range entry.Synonyms {
+				addCandidate(aid, synonym)
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		match.Alternatives = append(match.Alternatives, candidate)
+	}
+
+	sort.Slice(match.Alternatives, func(i, j int) bool {
+		a, b := match.Alternatives[i], match.Alternatives[j]
+
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+
+		return a.AID < b.AID
+	})
+
+	if len(match.Alternatives) == 0 {
+		return
+	}
+
+	match.ReleaseNameCandidate = match.Alternatives[0]
+	match.Found = true
+	match.Confidence = match.Score
+	match.Alternatives = match.Alternatives[1:]
+
+	return
+}
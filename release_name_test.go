@@ -0,0 +1,52 @@
+package otame
+
+import (
+	"reflect"
+	"testing"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestParseReleaseName(t *testing.T) {
+	tests := []struct {
+		name string
+		want ReleaseName
+	}{
+		{
+			"[SubsPlease] Sousou no Frieren - 12 (1080p) [ABCD1234].mkv",
+			ReleaseName{Group: "SubsPlease", Title: "Sousou no Frieren", Episode: intPtr(12), Resolution: "1080p", CRC: "ABCD1234", Extension: "mkv"},
+		},
+		{
+			"[Group] Title - 03v2 [720p][deadbeef].mp4",
+			ReleaseName{Group: "Group", Title: "Title", Episode: intPtr(3), Version: intPtr(2), Resolution: "720p", CRC: "DEADBEEF", Extension: "mp4"},
+		},
+		{
+			"[Group] Title - 05 [20240101].mkv",
+			ReleaseName{Group: "Group", Title: "Title", Episode: intPtr(5), Extension: "mkv"},
+		},
+		{
+			"Shingeki.no.Kyojin.S03E05.1080p.WEB.mkv",
+			ReleaseName{Title: "Shingeki no Kyojin", Season: intPtr(3), Episode: intPtr(5), Resolution: "1080p", Extension: "mkv"},
+		},
+		{
+			"[Group] Kimetsu no Yaiba 2nd Season - 04 (1920x1080 HEVC).mkv",
+			ReleaseName{Group: "Group", Title: "Kimetsu no Yaiba", Season: intPtr(2), Episode: intPtr(4), Resolution: "1920x1080", Extension: "mkv"},
+		},
+		{
+			"Some_Show_Episode_7.avi",
+			ReleaseName{Title: "Some Show", Episode: intPtr(7), Extension: "avi"},
+		},
+		{
+			"Movie Title",
+			ReleaseName{Title: "Movie Title"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := ParseReleaseName(test.name); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseReleaseName(%q) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package otame
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	TitleSourceAniDB = "anidb"
+	TitleSourceVNDB  = "vndb"
+	// Only searched by SearchAll, ResolveTitle returns an error for it.
+	TitleSourceAnimeOfflineDatabase = "aodb"
+)
+
+// Multipliers applied to the similarity of a candidate depending on
+// its title type, so that main titles win over synonyms of equal text.
+var (
+	AniDBTitleTypeWeights = map[string]float64{
+		AniDBEntryTypePrimary:  1,
+		AniDBEntryTypeOfficial: 1,
+		AniDBEntryTypeSynonym:  0.95,
+		AniDBEntryTypeShort:    0.9,
+	}
+	VNDBOfficialTitleWeight   = 1.0
+	VNDBUnofficialTitleWeight = 0.95
+)
+
+type TitleCandidate struct {
+	// One of the TitleSource* constants.
+	Source string
+	// AniDB aid or VNDB vnid.
+	ID       string
+	Title    string
+	Language string
+	// AniDB title type, or "official"/"unofficial" for VNDB titles.
+	TitleType string
+	// Title similarity weighted by title type and sequel marker, from 0 to 1.
+	Score float64
+}
+
+type TitleResolution struct {
+	Input string
+	// Best candidate, only valid if Found is true.
+	TitleCandidate
+	Found bool
+	// Equal to the best candidate's score.
+	Confidence float64
+	// Set when another anime or visual novel scored within
+	// ResolveOptions.AmbiguityMargin of the best candidate.
+	Ambiguous bool
+	// Best candidate per anime or visual novel, best first.
+	Candidates []TitleCandidate
+}
+
+type ResolveOptions struct {
+	// TitleSourceAniDB and TitleSourceVNDB to search, defaults to both.
+	Sources []string
+	// Number of titles fetched from each index, defaults to 20.
+	CandidateLimit int
+	// Defaults to 0.05.
+	AmbiguityMargin float64
+}
+
+func (o ResolveOptions) withDefaults() ResolveOptions {
+	if len(o.Sources) == 0 {
+		o.Sources = []string{TitleSourceAniDB, TitleSourceVNDB}
+	}
+
+	if o.CandidateLimit <= 0 {
+		o.CandidateLimit = 20
+	}
+
+	if o.AmbiguityMargin <= 0 {
+		o.AmbiguityMargin = 0.05
+	}
+
+	return o
+}
+
+func (o ResolveOptions) validate() error {
+	for _, s := range o.Sources {
+		if s != TitleSourceAniDB && s != TitleSourceVNDB {
+			return fmt.Errorf("unsupported resolve source: %s", s)
+		}
+	}
+
+	return nil
+}
+
+func (o ResolveOptions) hasSource(source string) bool {
+	for _, s := range o.Sources {
+		if s == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolves every title independently, see ResolveTitle.
+func ResolveTitles(titles []string, opts ResolveOptions) (resolutions []TitleResolution, err error) {
+	resolutions = make([]TitleResolution, 0, len(titles))
+
+	for _, title := range titles {
+		var resolution TitleResolution
+		resolution, err = ResolveTitle(title, opts)
+
+		if err != nil {
+			return
+		}
+
+		resolutions = append(resolutions, resolution)
+	}
+
+	return
+}
+
+// Matches a free-text title against every AniDB and VNDB title index
+// and scores the candidates by similarity and title type. Titles are
+// searched as written and without their sequel markers, and candidates
+// compared to the latter, the markers then being used to prefer the entry
+// of the franchise with the same season, see ParseSequelMarker.
+func ResolveTitle(title string, opts ResolveOptions) (resolution TitleResolution, err error) {
+	opts = opts.withDefaults()
+	resolution.Input = title
+
+	if err = opts.validate(); err != nil {
+		return
+	}
+
+	title = strings.Trim(strings.Join(strings.Fields(title), " "), `"'`)
+
+	if normalizeTitle(title) == "" {
+		return
+	}
+
+	base, marker := ParseSequelMarker(title)
+
+	// acronyms are only searched as written, see isAcronymQuery
+	if isAcronymQuery(title) {
+		base, marker = title, SequelMarker{Season: 1}
+	}
+
+	candidates, err := findTitleCandidates(title, base, marker, false, opts)
+
+	if err != nil {
+		return
+	}
+
+	if len(candidates) == 0 {
+		candidates, err = findTitleCandidates(title, base, marker, true, opts)
+
+		if err != nil {
+			return
+		}
+	}
+
+	resolution.Candidates = bestTitleCandidates(candidates)
+
+	if len(resolution.Candidates) == 0 {
+		return
+	}
+
+	resolution.TitleCandidate = resolution.Candidates[0]
+	resolution.Found = true
+	resolution.Confidence = resolution.Score
+	resolution.Ambiguous = len(resolution.Candidates) > 1 &&
+		resolution.Score-resolution.Candidates[1].Score <= opts.AmbiguityMargin
+
+	return
+}
+
+// Searches every index for titles containing all words of the title,
+// or any of them if anyWord is set, and likewise for the title without its
+// sequel markers, base, so that "Season 2" is found for "2nd Season".
+// Candidates are scored against base and the marker they make, or against
+// the title as written if found with it and closer, as markers may be part
+// of a title, such as the "VII" of "Final Fantasy VII: Advent Children".
+func findTitleCandidates(title string, base string, marker SequelMarker, anyWord bool, opts ResolveOptions) (candidates []TitleCandidate, err error) {
+	searchOpts := SearchOptions{Limit: opts.CandidateLimit, Mode: SearchModeSimple}
+	queries := []string{title}
+
+	if normalizeTitle(base) != "" && normalizeTitle(base) != normalizeTitle(title) {
+		queries = append(queries, base)
+	}
+
+	if anyWord {
+		searchOpts.Mode = SearchModeAdvanced
+
+		for i, query := range queries {
+			queries[i] = anyWordMatchQuery(query)
+		}
+	}
+
+	if opts.hasSource(TitleSourceAniDB) {
+		for _, index := range aniDBTitleIndexes {
+			var entries []AniDBSearchResult
+			// entries found with the title as written, which come first
+			written := 0
+
+			for i, query := range queries {
+				var found []AniDBSearchResult
+				found, err = searchAniDBTitleIndexes(query, []titleIndex{index}, false, searchOpts)
+
+				if err != nil {
+					return
+				}
+
+				if i == 0 {
+					written = len(found)
+				}
+
+				entries = append(entries, found...)
+			}
+
+			for i, entry := range entries {
+				weight, ok := AniDBTitleTypeWeights[entry.Type]
+
+				if !ok {
+					weight = 1
+				}
+
+				matched := entry.Title
+
+				if entry.GeneratedRomaji != "" {
+					matched = entry.GeneratedRomaji
+				}
+
+				if entry.Alias != "" {
+					matched = entry.Alias
+				}
+
+				similarity := sequelTitleSimilarity(base, marker, matched)
+
+				if i < written {
+					similarity = max(similarity, titleSimilarity(title, matched))
+				}
+
+				if entry.Acronym != "" {
+					similarity = AcronymMatchWeight * titleSimilarity(title, entry.Acronym)
+				}
+
+				candidates = append(candidates, TitleCandidate{
+					Source:    TitleSourceAniDB,
+					ID:        entry.AID,
+					Title:     matched,
+					Language:  entry.Language,
+					TitleType: entry.Type,
+					Score:     weight * similarity,
+				})
+			}
+		}
+	}
+
+	if opts.hasSource(TitleSourceVNDB) {
+		for _, index := range vndbTitleIndexes {
+			var entries []VNDBSearchResult
+			// entries found with the title as written, which come first
+			written := 0
+
+			for i, query := range queries {
+				var found []VNDBSearchResult
+				found, err = searchVNDBTitleIndexes(query, []titleIndex{index}, false, searchOpts)
+
+				if err != nil {
+					return
+				}
+
+				if i == 0 {
+					written = len(found)
+				}
+
+				entries = append(entries, found...)
+			}
+
+			for i, entry := range entries {
+				weight, titleType := VNDBUnofficialTitleWeight, "unofficial"
+
+				if entry.Official {
+					weight, titleType = VNDBOfficialTitleWeight, "official"
+				}
+
+				matched := entry.Title
+
+				if entry.MatchedLatin && entry.Latin != nil {
+					matched = *entry.Latin
+				}
+
+				if entry.GeneratedRomaji != "" {
+					matched = entry.GeneratedRomaji
+				}
+
+				if entry.Alias != "" {
+					matched = entry.Alias
+				}
+
+				similarity := sequelTitleSimilarity(base, marker, matched)
+
+				if i < written {
+					similarity = max(similarity, titleSimilarity(title, matched))
+				}
+
+				if entry.Acronym != "" {
+					similarity = AcronymMatchWeight * titleSimilarity(title, entry.Acronym)
+				}
+
+				candidates = append(candidates, TitleCandidate{
+					Source:    TitleSourceVNDB,
+					ID:        entry.VNID,
+					Title:     matched,
+					Language:  entry.Language,
+					TitleType: titleType,
+					Score:     weight * similarity,
+				})
+			}
+		}
+	}
+
+	return
+}
+
+// Keeps the best scoring candidate of each anime or visual novel,
+// sorted by score.
+func bestTitleCandidates(candidates []TitleCandidate) (best []TitleCandidate) {
+	indexes := make(map[string]int)
+
+	for _, candidate := range candidates {
+		key := candidate.Source + ":" + candidate.ID
+		i, ok := indexes[key]
+
+		if !ok {
+			indexes[key] = len(best)
+			best = append(best, candidate)
+		} else if candidate.Score > best[i].Score {
+			best[i] = candidate
+		}
+	}
+
+	sort.SliceStable(best, func(i, j int) bool {
+		return best[i].Score > best[j].Score
+	})
+
+	return
+}
@@ -0,0 +1,58 @@
+package otame
+
+import (
+	"database/sql"
+)
+
+type ResolvedURL struct {
+	Provider Provider
+	// ID as parsed from the URL, see ParseProviderURL.
+	ID string
+	// Set for URLs of anime providers.
+	Anime *AnimeOfflineDatabaseEntry
+	// Set for VNDB URLs. Releases and characters can
+	// belong to more than one visual novel.
+	VisualNovels []VNDBVisualNovelEntry
+}
+
+// Resolves a pasted anime provider or VNDB URL to the matching entries.
+// Returns ErrUnrecognizedURL for URLs no provider accepts, and
+// sql.ErrNoRows if the URL is recognized but nothing matches it.
+func ResolveURL(url string) (resolved ResolvedURL, err error) {
+	resolved.Provider, resolved.ID, err = ParseProviderURL(url)
+
+	if err != nil {
+		return
+	}
+
+	if resolved.Provider != ProviderVNDB {
+		var entry AnimeOfflineDatabaseEntry
+		entry, err = GetAnimeOfflineDatabaseEntryBySource(string(resolved.Provider), resolved.ID)
+
+		if err == nil {
+			resolved.Anime = &entry
+		}
+
+		return
+	}
+
+	switch resolved.ID[0] {
+	case 'v':
+		var entry VNDBVisualNovelEntry
+		entry, err = GetVNDBVisualNovelByID(resolved.ID)
+
+		if err == nil {
+			resolved.VisualNovels = []VNDBVisualNovelEntry{entry}
+		}
+	case 'r':
+		resolved.VisualNovels, err = GetVNDBVisualNovelsByReleaseID(resolved.ID)
+	case 'c':
+		resolved.VisualNovels, err = GetVNDBVisualNovelsByCharacterID(resolved.ID)
+	}
+
+	if err == nil && len(resolved.VisualNovels) == 0 {
+		err = sql.ErrNoRows
+	}
+
+	return
+}
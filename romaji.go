@@ -0,0 +1,526 @@
+package otame
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Hepburn romanization of each hiragana, small kana included.
+// Katakana are romanized as the matching hiragana.
+var hiraganaRomaji = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa",
+}
+
+func isKana(r rune) bool {
+	return unicode.In(r, unicode.Hiragana, unicode.Katakana) || r == 'ー'
+}
+
+// Maps katakana to the matching hiragana.
+func toHiragana(r rune) rune {
+	if r >= 'ァ' && r <= 'ヶ' {
+		return r - 'ァ' + 'ぁ'
+	}
+
+	return r
+}
+
+// Reports whether every letter of s is kana, and there is at least one.
+func IsKana(s string) bool {
+	hasKana := false
+
+	for _, r := range s {
+		if isKana(r) {
+			hasKana = true
+		} else if unicode.IsLetter(r) {
+			return false
+		}
+	}
+
+	return hasKana
+}
+
+// Romanizes the kana of s using Hepburn, with long vowels spelled as
+// written in kana ("ou", "ii") and the prolonged sound mark doubling the
+// previous vowel. Other characters are kept, and a space is put between
+// runs of hiragana and katakana, which usually are separate words.
+func KanaToRomaji(s string) string {
+	// romanized syllables and other characters, in order
+	var parts []string
+	// previous rune, if kana
+	var previousKana rune
+	doubleNext := false
+
+	for _, r := range s {
+		if !isKana(r) {
+			if r == '・' || r == '　' {
+				r = ' '
+			}
+
+			if doubleNext {
+				parts = append(parts, "tsu")
+				doubleNext = false
+			}
+
+			parts = append(parts, string(r))
+			previousKana = 0
+			continue
+		}
+
+		if r == 'ー' {
+			if len(parts) > 0 {
+				parts = append(parts, lastVowel(parts[len(parts)-1]))
+			}
+
+			continue
+		}
+
+		if previousKana != 0 && unicode.Is(unicode.Hiragana, r) != unicode.Is(unicode.Hiragana, previousKana) {
+			parts = append(parts, " ")
+		}
+
+		previousKana = r
+		h := toHiragana(r)
+
+		if h == 'っ' {
+			doubleNext = true
+			continue
+		}
+
+		romaji, ok := hiraganaRomaji[h]
+
+		if !ok {
+			parts = append(parts, string(r))
+			continue
+		}
+
+		if last := len(parts) - 1; last >= 0 && isSmallKana(h) && lastVowel(parts[last]) != "" {
+			parts[last] = combineSmallKana(parts[last], romaji)
+			continue
+		}
+
+		if doubleNext {
+			if strings.HasPrefix(romaji, "ch") {
+				romaji = "t" + romaji
+			} else if !strings.ContainsRune("aiueon", rune(romaji[0])) {
+				romaji = romaji[:1] + romaji
+			}
+
+			doubleNext = false
+		}
+
+		parts = append(parts, romaji)
+	}
+
+	if doubleNext {
+		parts = append(parts, "tsu")
+	}
+
+	return strings.Join(parts, "")
+}
+
+// Romaji of a kana title for the index of generated romaji, given the
+// words the ICU tokenizer splits it into, separated by spaces. Katakana
+// words are joined back together, as the tokenizer splits loanwords apart,
+// and so are words split at a small kana or before a prolonged sound mark.
+// As hiragana words are not always split right either, titles of several
+// words also get their romaji without spaces, see spacelessRomaji.
+func generatedRomaji(title string, tokens string) string {
+	var words []string
+	previousKatakana := false
+
+	for _, token := range strings.Fields(tokens) {
+		if strings.IndexFunc(token, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			previousKatakana = false
+			continue
+		}
+
+		katakana := strings.IndexFunc(token, func(r rune) bool { return !unicode.Is(unicode.Katakana, r) && r != 'ー' }) < 0
+		first, _ := utf8.DecodeRuneInString(token)
+		last := len(words) - 1
+
+		if last >= 0 && (katakana && previousKatakana || first == 'ー' || isSmallKana(toHiragana(first)) ||
+			strings.HasSuffix(words[last], "っ") || strings.HasSuffix(words[last], "ッ")) {
+			words[last] += token
+		} else {
+			words = append(words, token)
+		}
+
+		previousKatakana = katakana
+	}
+
+	for i, word := range words {
+		words[i] = KanaToRomaji(word)
+	}
+
+	romaji := NormalizeRomaji(strings.Join(words, " "))
+
+	if len(strings.Fields(normalizeTitle(romaji))) > 1 {
+		romaji += " " + spacelessRomaji(KanaToRomaji(title))
+	}
+
+	return romaji
+}
+
+// Normalizes romaji with its words joined, as indexed for kana titles by
+// generatedRomaji, so that queries may be compared without spaces.
+func spacelessRomaji(s string) string {
+	return NormalizeRomaji(strings.ReplaceAll(normalizeTitle(s), " ", ""))
+}
+
+func isSmallKana(r rune) bool {
+	return strings.ContainsRune("ぁぃぅぇぉゃゅょゎ", r)
+}
+
+// Romanizes a syllable followed by a small kana, such as
+// "ki"+"ya" (kya), "shi"+"yo" (sho), "fu"+"a" (fa) or "te"+"i" (ti).
+func combineSmallKana(syllable string, small string) string {
+	palatal := strings.HasSuffix(syllable, "shi") || strings.HasSuffix(syllable, "chi") || strings.HasSuffix(syllable, "ji")
+
+	switch {
+	case strings.HasPrefix(small, "y") && palatal:
+		return strings.TrimSuffix(syllable, "i") + small[1:]
+	case strings.HasPrefix(small, "y") && strings.HasSuffix(syllable, "i") && len(syllable) > 1:
+		return strings.TrimSuffix(syllable, "i") + small
+	case strings.HasPrefix(small, "y") || small == "wa":
+		return syllable + small
+	case syllable == "u":
+		return "w" + small
+	case strings.HasSuffix(syllable, "fu") || strings.HasSuffix(syllable, "vu") || strings.HasSuffix(syllable, "tsu"):
+		return strings.TrimSuffix(syllable, "u") + small
+	case (strings.HasSuffix(syllable, "te") || strings.HasSuffix(syllable, "de")) && (small == "i" || small == "u"):
+		return strings.TrimSuffix(syllable, "e") + small
+	case palatal && small == "e":
+		return strings.TrimSuffix(syllable, "i") + small
+	}
+
+	return syllable + small
+}
+
+func lastVowel(romaji string) string {
+	if romaji == "" {
+		return ""
+	}
+
+	if last := romaji[len(romaji)-1]; strings.ContainsRune("aiueo", rune(last)) {
+		return string(last)
+	}
+
+	return ""
+}
+
+var (
+	romajiDiacriticReplacer = strings.NewReplacer(
+		"ā", "a", "â", "a",
+		"ī", "i", "î", "i",
+		"ū", "u", "û", "u",
+		"ē", "e", "ê", "e",
+		"ō", "o", "ô", "o",
+	)
+	// Hepburn spellings to Kunrei-shiki, longest first
+	romajiConsonantReplacer = strings.NewReplacer(
+		"tchi", "tti", "cchi", "tti", "tch", "tty", "cch", "tty",
+		"shi", "si", "chi", "ti", "tsu", "tu",
+		"sh", "sy", "ch", "ty", "fu", "hu",
+		"ji", "zi", "j", "zy",
+		"wo", "o", "n'", "n",
+		"mb", "nb", "mp", "np",
+	)
+	romajiLongVowelReplacer = strings.NewReplacer(
+		"ou", "o", "oo", "o",
+		"uu", "u", "aa", "a",
+		"ii", "i", "ee", "e",
+	)
+)
+
+// Consonants a romaji syllable may start with, before its vowel.
+var romajiOnsets = map[string]bool{
+	"k": true, "g": true, "s": true, "z": true, "t": true, "d": true, "n": true,
+	"h": true, "b": true, "p": true, "m": true, "y": true, "r": true, "w": true,
+	"f": true, "j": true, "v": true, "sh": true, "ch": true, "ts": true,
+	"ky": true, "gy": true, "sy": true, "zy": true, "ty": true, "dy": true,
+	"ny": true, "hy": true, "by": true, "py": true, "my": true, "ry": true,
+	"jy": true, "cy": true, "fy": true,
+}
+
+// Normalized form of the consonants a prefix may end with before
+// the vowel of its last syllable, the longest of those they may be
+// the start of being kept, such as "s" for "sh" as in "shi" and "sha".
+var romajiPartialOnsets = map[string]string{
+	"sh": "s", "ch": "t", "c": "t", "ts": "t", "tc": "t", "cc": "t",
+	"j": "z", "jy": "zy", "f": "h",
+}
+
+// Folds the spelling variants of romaji to a canonical form, so that
+// "Shoujo", "Shōjo", "Syouzyo" and "Shojo" are all written "syozyo".
+// Macrons and circumflexes are dropped, Hepburn spellings turned into
+// Kunrei-shiki, and long vowels shortened. Words which are not a sequence
+// of romaji syllables, such as "World", are only lower cased. The result
+// is only meant to be compared with other normalized romaji.
+func NormalizeRomaji(s string) string {
+	return normalizeRomajiWords(s, nil)
+}
+
+// Normalizes each word of s, leaving what separates them as it is. Words
+// for which keep returns true, given the text following them, are only
+// lower cased and stripped of diacritics.
+func normalizeRomajiWords(s string, keep func(rest string) bool) string {
+	s = romajiDiacriticReplacer.Replace(strings.ToLower(s))
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		end := romajiWordEnd(s, i)
+
+		if end == i {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		word := s[i:end]
+
+		if keep != nil && keep(s[end:]) {
+			b.WriteString(word)
+		} else if _, partial, ok := splitRomajiSyllables(word); ok && partial == "" {
+			b.WriteString(normalizeRomajiSyllables(word))
+		} else {
+			b.WriteString(word)
+		}
+
+		i = end
+	}
+
+	return b.String()
+}
+
+// End of the word of lower case letters starting at i, which is i if there
+// is none. An apostrophe only separates a syllabic n from a vowel or y, so
+// "shin'ichi" is one word.
+func romajiWordEnd(s string, i int) int {
+	for ; i < len(s); i++ {
+		apostrophe := s[i] == '\'' && i > 0 && s[i-1] == 'n' && i+1 < len(s) && isRomajiLetter(s[i+1])
+
+		if !isRomajiLetter(s[i]) && !apostrophe {
+			break
+		}
+	}
+
+	return i
+}
+
+func isRomajiLetter(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func normalizeRomajiSyllables(word string) string {
+	return romajiLongVowelReplacer.Replace(romajiConsonantReplacer.Replace(word))
+}
+
+// Normalizes a word being typed, which may end with the consonants of an
+// unfinished syllable, so that "ts" still finds "tsubasa", or "tubasa"
+// once normalized. The result matches the start of the normalized word.
+func normalizeRomajiPrefix(word string) string {
+	complete, partial, ok := splitRomajiSyllables(word)
+
+	if !ok {
+		return word
+	}
+
+	if normalized, ok := romajiPartialOnsets[partial]; ok {
+		partial = normalized
+	}
+
+	return normalizeRomajiSyllables(complete) + partial
+}
+
+// Splits a lower case word into its complete romaji syllables and the
+// consonants of an unfinished last syllable, if any. Returns false if the
+// word is not made of romaji syllables, such as most English words.
+func splitRomajiSyllables(word string) (complete string, partial string, ok bool) {
+	isVowel := func(c byte) bool {
+		return strings.IndexByte("aiueo", c) >= 0
+	}
+
+	i := 0
+
+	for i < len(word) {
+		c := word[i]
+
+		switch {
+		case isVowel(c), c == '\'':
+			i++
+			continue
+		// syllabic n, or m before a labial
+		case c == 'n' && (i+1 == len(word) || !isVowel(word[i+1]) && word[i+1] != 'y'),
+			c == 'm' && i+1 < len(word) && strings.IndexByte("bpm", word[i+1]) >= 0:
+			i++
+			continue
+		// doubled consonant of a small tsu
+		case i+1 < len(word) && !isVowel(c) && (word[i+1] == c || c == 't' && word[i+1] == 'c'):
+			i++
+			continue
+		}
+
+		onset := ""
+
+		for length := min(3, len(word)-i-1); length > 0; length-- {
+			if romajiOnsets[word[i:i+length]] && isVowel(word[i+length]) {
+				onset = word[i : i+length]
+				break
+			}
+		}
+
+		if onset == "" {
+			break
+		}
+
+		i += len(onset) + 1
+	}
+
+	complete, partial = word[:i], word[i:]
+
+	if partial == "" {
+		return complete, partial, true
+	}
+
+	for onset := range romajiOnsets {
+		if strings.HasPrefix(onset, partial) {
+			return complete, partial, true
+		}
+	}
+
+	_, ok = romajiPartialOnsets[partial]
+
+	return
+}
+
+// Normalizes every word of an FTS query with NormalizeRomaji, leaving out
+// the operators of advanced queries. The last word of prefix queries, and
+// the words of advanced queries followed by *, may be unfinished and are
+// left to expandRomajiPrefixes.
+func normalizeRomajiQuery(query string, mode SearchMode) string {
+	switch mode {
+	case SearchModePrefix:
+		return normalizeRomajiWords(query, func(rest string) bool {
+			return strings.IndexFunc(rest, func(r rune) bool {
+				return unicode.IsLetter(r) || unicode.IsDigit(r)
+			}) < 0
+		})
+	case SearchModeAdvanced:
+		words := strings.Fields(query)
+
+		for i, word := range words {
+			if word != "OR" && word != "AND" && word != "NOT" && !strings.HasPrefix(word, "NEAR") {
+				words[i] = normalizeRomajiWords(word, func(rest string) bool {
+					return strings.HasPrefix(rest, "*")
+				})
+			}
+		}
+
+		return strings.Join(words, " ")
+	}
+
+	return NormalizeRomaji(query)
+}
+
+// Rewrites the prefix terms of a MATCH expression built from a query
+// normalized with normalizeRomajiQuery, so that they match both the
+// normalized romaji they may be the start of and words left as written,
+// such as "wor*" becoming "(or* OR wor*)" to find "World" as well as
+// "Wonder". Prefixes within phrases or next to NEAR, where OR is not
+// allowed, are only normalized.
+func expandRomajiPrefixes(match string) string {
+	var b strings.Builder
+	phrase := false
+
+	for i := 0; i < len(match); {
+		end := romajiWordEnd(match, i)
+
+		if end == i || end == len(match) || match[end] != '*' {
+			if end == i {
+				phrase = phrase != (match[i] == '"')
+				end++
+			}
+
+			b.WriteString(match[i:end])
+			i = end
+			continue
+		}
+
+		word := match[i:end]
+		normalized := normalizeRomajiPrefix(word)
+		before := strings.Fields(match[:i])
+		after := strings.Fields(match[end+1:])
+		near := len(before) > 0 && strings.HasPrefix(before[len(before)-1], "NEAR") ||
+			len(after) > 0 && strings.HasPrefix(after[0], "NEAR")
+
+		switch {
+		case phrase || near:
+			b.WriteString(normalized + "*")
+		case normalized != word:
+			b.WriteString("(" + normalized + "* OR " + word + "*)")
+		default:
+			b.WriteString(word + "*")
+		}
+
+		i = end + 1
+	}
+
+	return b.String()
+}
+
+// Spans of the words of text which, normalized, start with a
+// normalized word of the query.
+func romajiWordSpans(text string, query string) (spans []MatchSpan) {
+	terms := strings.Fields(normalizeTitle(query))
+	start := -1
+
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+
+		word := NormalizeRomaji(text[start:end])
+
+		for _, term := range terms {
+			if strings.HasPrefix(word, term) {
+				spans = append(spans, MatchSpan{start, end})
+				break
+			}
+		}
+
+		start = -1
+	}
+
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+		} else {
+			flush(i)
+		}
+	}
+
+	flush(len(text))
+
+	return
+}
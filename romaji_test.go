@@ -0,0 +1,76 @@
+package otame
+
+import "testing"
+
+func TestNormalizeRomaji(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Shoujo", "syozyo"},
+		{"Shōjo", "syozyo"},
+		{"Syouzyo", "syozyo"},
+		{"Shojo", "syozyo"},
+		{"Tsubasa", "tubasa"},
+		{"Shin'ichi", "siniti"},
+		{"Matcha", "mattya"},
+		{"Sempai", "senpai"},
+		{"Oniisan", "onisan"},
+		{"Kimi no Na wa.", "kimi no na wa."},
+		// words which are not romaji are only lower cased
+		{"World", "world"},
+		{"Dynasty", "dynasty"},
+		// d is not folded into z, which would merge unrelated names
+		{"Dio", "dio"},
+		{"Jio", "zio"},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeRomaji(test.text); got != test.want {
+			t.Errorf("NormalizeRomaji(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeRomajiPrefix(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"ts", "t"},
+		{"tsub", "tub"},
+		{"sh", "s"},
+		{"chi", "ti"},
+		{"j", "z"},
+		{"kyo", "kyo"},
+		{"shoujo", "syozyo"},
+		{"wor", "or"},
+	}
+
+	for _, test := range tests {
+		if got := normalizeRomajiPrefix(test.word); got != test.want {
+			t.Errorf("normalizeRomajiPrefix(%q) = %q, want %q", test.word, got, test.want)
+		}
+	}
+}
+
+func TestExpandRomajiPrefixes(t *testing.T) {
+	tests := []struct {
+		match string
+		want  string
+	}{
+		{`tsu*`, `(tu* OR tsu*)`},
+		{`"kimi" "no" wor*`, `"kimi" "no" (or* OR wor*)`},
+		{`kyo*`, `kyo*`},
+		{`world`, `world`},
+		// OR is not allowed within phrases or next to NEAR
+		{`"sh* zyo"`, `"s* zyo"`},
+		{`"syo" NEAR sh*`, `"syo" NEAR s*`},
+	}
+
+	for _, test := range tests {
+		if got := expandRomajiPrefixes(test.match); got != test.want {
+			t.Errorf("expandRomajiPrefixes(%q) = %q, want %q", test.match, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,1295 @@
+package otame
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Weight of each language index in searches spanning several of them.
+// Languages missing from the map have a weight of 1.
+var SearchLanguageWeights = map[string]float64{
+	"ja":    1,
+	"en":    1,
+	"x_jat": 1,
+}
+
+// Share of the FTS rank in the score of a match, the rest being the
+// similarity of the matched title to the query. Ranks are normalized
+// to [0, 1) as rank/(rank+1), so that scores of matches from different
+// indexes are comparable.
+var SearchRankWeight = 0.3
+
+var ErrInvalidCursor = errors.New("invalid search cursor")
+
+type SearchOptions struct {
+	// Maximum number of results, defaults to 20.
+	Limit int
+	// Number of results to skip.
+	Offset int
+	// NextCursor of a previous page, takes precedence over Offset. Cursors
+	// are bound to the source, query and options they were returned for,
+	// and are rejected with ErrInvalidCursor by any other.
+	Cursor string
+	// How the query is turned into a MATCH expression, see BuildMatchQuery.
+	Mode SearchMode
+	// Languages of the titles to search, such as "ko" or "zh-Hans".
+	// Defaults to every language.
+	Languages []string
+	// Whether to boost popular anime and visual novels, and main titles
+	// over synonyms, see DefaultPopularityFunc.
+	Popularity bool
+	// Combines scores with popularity in place of DefaultPopularityFunc,
+	// if Popularity is set.
+	PopularityFunc PopularityFunc
+}
+
+func (o SearchOptions) withDefaults() SearchOptions {
+	if o.Limit <= 0 {
+		o.Limit = 20
+	}
+
+	if o.Offset < 0 {
+		o.Offset = 0
+	}
+
+	return o
+}
+
+// Identifies the results a cursor pages through: those of
+// the same content table, query and options.
+func searchCursorKey(table string, query string, opts SearchOptions) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s\x00%t\x00%t", table, query, opts.Mode, strings.Join(opts.Languages, ","), opts.Popularity, opts.PopularityFunc != nil)
+
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// Offset of the first result, read from the cursor if there is one,
+// in which case it must have been made with the same key.
+func (o SearchOptions) offset(key string) (offset int, err error) {
+	if o.Cursor == "" {
+		return o.Offset, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+
+	if err != nil {
+		err = ErrInvalidCursor
+		return
+	}
+
+	offsetText, cursorKey, ok := strings.Cut(string(decoded), ":")
+
+	if !ok || cursorKey != key {
+		err = ErrInvalidCursor
+		return
+	}
+
+	offset, err = strconv.Atoi(offsetText)
+
+	if err != nil || offset < 0 {
+		offset, err = 0, ErrInvalidCursor
+	}
+
+	return
+}
+
+func encodeSearchCursor(offset int, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset) + ":" + key))
+}
+
+// Cursor of the page after results, or "" if there are no more results.
+func nextSearchCursor(offset int, results int, total int, key string) string {
+	if offset+results >= total {
+		return ""
+	}
+
+	return encodeSearchCursor(offset+results, key)
+}
+
+type AniDBSearchResult struct {
+	AniDBEntry
+	Score float64
+	// Parts of the title matched by the query, see Highlight.
+	Spans []MatchSpan
+	// Romaji generated for a kana title, set when the query
+	// matched it, in which case Spans refer to it.
+	GeneratedRomaji string
+	// User alias of the anime, set when the query matched it rather than
+	// a title, in which case the entry is the main title and Spans refer
+	// to the alias.
+	Alias string
+	// Acronym of the title, set when the query matched it rather
+	// than the title, in which case Spans mark its initials.
+	Acronym string
+}
+
+func (r *AniDBSearchResult) setMatch(m titleMatch) {
+	switch m.column {
+	case "romaji":
+		r.GeneratedRomaji = KanaToRomaji(r.Title)
+		r.Spans = m.spans(r.GeneratedRomaji)
+	case "alias":
+		r.Alias = m.text
+		r.Spans = m.spans(r.Alias)
+	case "acronym":
+		r.Acronym = m.text
+		r.Spans = acronymSpans(r.Title, r.Acronym)
+	default:
+		r.Spans = m.spans(r.Title)
+	}
+}
+
+// Returns the matched title, generated romaji or alias with
+// every matched part wrapped in open and close.
+func (r AniDBSearchResult) Highlight(open string, close string) string {
+	if r.GeneratedRomaji != "" {
+		return highlightSpans(r.GeneratedRomaji, r.Spans, open, close)
+	}
+
+	if r.Alias != "" {
+		return highlightSpans(r.Alias, r.Spans, open, close)
+	}
+
+	return highlightSpans(r.Title, r.Spans, open, close)
+}
+
+type VNDBSearchResult struct {
+	VNDBTitleEntry
+	Score float64
+	// Parts of the title matched by the query, see Highlight.
+	Spans []MatchSpan
+	// Set when the query matched the romanization of the title,
+	// in which case Spans refer to Latin instead of Title.
+	MatchedLatin bool
+	// Same as AniDBSearchResult.GeneratedRomaji.
+	GeneratedRomaji string
+	// Same as AniDBSearchResult.Alias.
+	Alias string
+	// Same as AniDBSearchResult.Acronym, made from Latin if there is one.
+	Acronym string
+}
+
+func (r *VNDBSearchResult) setMatch(m titleMatch) {
+	switch {
+	case m.column == "romaji":
+		r.GeneratedRomaji = KanaToRomaji(r.Title)
+		r.Spans = m.spans(r.GeneratedRomaji)
+	case m.column == "alias":
+		r.Alias = m.text
+		r.Spans = m.spans(r.Alias)
+	case m.column == "acronym" && r.Latin != nil:
+		r.Acronym = m.text
+		r.MatchedLatin = true
+		r.Spans = acronymSpans(*r.Latin, r.Acronym)
+	case m.column == "acronym":
+		r.Acronym = m.text
+		r.Spans = acronymSpans(r.Title, r.Acronym)
+	case m.column == "latin" && r.Latin != nil:
+		r.MatchedLatin = true
+		r.Spans = m.spans(*r.Latin)
+	default:
+		r.Spans = m.spans(r.Title)
+	}
+}
+
+// Returns the matched title, romanization or alias with
+// every matched part wrapped in open and close.
+func (r VNDBSearchResult) Highlight(open string, close string) string {
+	if r.GeneratedRomaji != "" {
+		return highlightSpans(r.GeneratedRomaji, r.Spans, open, close)
+	}
+
+	if r.Alias != "" {
+		return highlightSpans(r.Alias, r.Spans, open, close)
+	}
+
+	if r.MatchedLatin && r.Latin != nil {
+		return highlightSpans(*r.Latin, r.Spans, open, close)
+	}
+
+	return highlightSpans(r.Title, r.Spans, open, close)
+}
+
+// One anime of a grouped search.
+type AniDBAnimeSearchResult struct {
+	AID string
+	// Main title of the anime.
+	DisplayTitle string
+	// Best matching title of the anime, and its score.
+	Match AniDBSearchResult
+}
+
+// One visual novel of a grouped search.
+type VNDBVisualNovelSearchResult struct {
+	VNID string
+	// Title in the original language, romanized if possible.
+	DisplayTitle string
+	// Best matching title of the visual novel, and its score.
+	Match VNDBSearchResult
+}
+
+type AniDBSearchPage struct {
+	Results []AniDBSearchResult
+	// Number of matches over all pages.
+	Total int
+	// Cursor of the next page, empty on the last page.
+	NextCursor string
+}
+
+type VNDBSearchPage struct {
+	Results    []VNDBSearchResult
+	Total      int
+	NextCursor string
+}
+
+type AniDBAnimeSearchPage struct {
+	Results []AniDBAnimeSearchResult
+	// Number of matching anime over all pages.
+	Total      int
+	NextCursor string
+}
+
+type VNDBVisualNovelSearchPage struct {
+	Results []VNDBVisualNovelSearchResult
+	// Number of matching visual novels over all pages.
+	Total      int
+	NextCursor string
+}
+
+// How a result matched, read from its row of titleSearch.matchesSQL.
+type titleMatch struct {
+	offsets    string
+	text       string
+	column     string
+	normalized bool
+	query      string
+}
+
+// Parts of text, the matched title or romanization, matched by the query.
+// Offsets of normalized romaji do not point into the text, so the words
+// of the text are compared to those of the query instead.
+func (m titleMatch) spans(text string) []MatchSpan {
+	if m.normalized {
+		return romajiWordSpans(text, m.query)
+	}
+
+	return parseMatchOffsets(m.offsets)
+}
+
+type titleIndex struct {
+	table string
+	// Language of the indexed titles, or "" for an all-language index.
+	language string
+	// Scripts of the queries the index is searched with, see routeQuery.
+	// Indexes without a script are searched with any query.
+	scripts []string
+	// Languages an all-language index is restricted to, or
+	// excluded from if excludeLanguages is set.
+	languages        []string
+	excludeLanguages bool
+	// Indexed column of the content table, defaults to title.
+	indexedColumn string
+	// Whether the index holds romaji normalized with NormalizeRomaji.
+	normalized bool
+	// Whether the index also holds titles with their words joined,
+	// searched with the query without spaces, see spacelessRomaji.
+	spaceless bool
+	// Content table whose anime or visual novels the aliases of an
+	// alias index are matched to, see userAliasIndex.
+	aliasTable string
+	// Whether the index is a table of title acronyms, searched
+	// only with queries that look like one, see isAcronymQuery.
+	acronym bool
+	// Weight of the matches, in place of that of their language.
+	fixedWeight *float64
+	// Expression giving the ID in the content table of a docid, for
+	// indexes of other tables, or the ID column of acronym tables.
+	contentID string
+}
+
+func (i titleIndex) docid() string {
+	if i.contentID == "" {
+		return "docid"
+	}
+
+	return i.contentID
+}
+
+func (i titleIndex) column() string {
+	if i.indexedColumn == "" {
+		return "title"
+	}
+
+	return i.indexedColumn
+}
+
+// Restricts an all-language index to titles of the languages,
+// or to titles of any other language if exclude is set.
+func (i titleIndex) restrict(languages []string, exclude bool) titleIndex {
+	i.languages = languages
+	i.excludeLanguages = exclude
+	return i
+}
+
+// Restricts the index to titles of the languages, on top of any restriction
+// it already has. Returns false if the index holds none of them. Alias
+// indexes are left as they are, as aliases have no language.
+func (i titleIndex) restrictTo(languages []string) (restricted titleIndex, ok bool) {
+	if i.aliasTable != "" {
+		return i, true
+	}
+
+	// titles of a language index all have its language, except generated
+	// romaji, whose index is weighted as romaji but holds kana titles
+	if i.language != "" && i.column() != "romaji" {
+		return i, containsString(languages, i.language)
+	}
+
+	var kept []string
+
+	for _, language := range languages {
+		if len(i.languages) == 0 || containsString(i.languages, language) != i.excludeLanguages {
+			kept = append(kept, language)
+		}
+	}
+
+	return i.restrict(kept, false), len(kept) > 0
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Join of the content table to the rows of the index and condition on the
+// language of the joined title, both empty if the index is not restricted.
+// The condition takes the languages as arguments.
+func (i titleIndex) languageFilterSQL(table string, docid string) (join string, condition string) {
+	if len(i.languages) == 0 {
+		return
+	}
+
+	operator := "IN"
+
+	if i.excludeLanguages {
+		operator = "NOT IN"
+	}
+
+	join = fmt.Sprintf("JOIN %s ON %s.id = %s", table, table, docid)
+	condition = fmt.Sprintf("AND %s.language %s (%s)", table, operator, sqlPlaceholders(len(i.languages)))
+
+	return
+}
+
+// fts4aux table exposing the vocabulary of the index.
+func (i titleIndex) vocabTable() string {
+	return strings.TrimSuffix(i.table, "_idx") + "_vocab"
+}
+
+func (i titleIndex) weight() float64 {
+	if i.aliasTable != "" {
+		return UserAliasBoost
+	}
+
+	if i.acronym {
+		return AcronymMatchWeight
+	}
+
+	if i.fixedWeight != nil {
+		return *i.fixedWeight
+	}
+
+	language := i.language
+
+	if language == "" && len(i.languages) == 1 && !i.excludeLanguages {
+		language = i.languages[0]
+	}
+
+	if weight, ok := SearchLanguageWeights[language]; ok {
+		return weight
+	}
+
+	return 1
+}
+
+var (
+	// also searched with the Latin part of queries, separately from their
+	// Japanese part, as many Japanese titles are written in Latin script
+	// without a romanization, such as "BALDR SKY", and are found in no
+	// other index
+	aniDBJapaneseTitleIndex = titleIndex{table: "anidb_titles_ja_fts_idx", language: "ja", scripts: []string{ScriptJapanese, ScriptLatin}}
+	aniDBEnglishTitleIndex  = titleIndex{table: "anidb_titles_en_fts_idx", language: "en", scripts: []string{ScriptLatin}}
+	aniDBRomajiTitleIndex   = titleIndex{table: "anidb_titles_x_jat_norm_fts_idx", language: "x_jat", scripts: []string{ScriptLatin}, normalized: true}
+	aniDBAllTitleIndex      = titleIndex{table: "anidb_titles_all_fts_idx"}
+	vndbJapaneseTitleIndex  = titleIndex{table: "vndb_titles_ja_fts_idx", language: "ja", scripts: []string{ScriptJapanese, ScriptLatin}}
+	vndbEnglishTitleIndex   = titleIndex{table: "vndb_titles_en_fts_idx", language: "en", scripts: []string{ScriptLatin}}
+	vndbAllTitleIndex       = titleIndex{table: "vndb_titles_all_fts_idx"}
+	vndbRomajiTitleIndex    = titleIndex{table: "vndb_titles_latin_norm_fts_idx", scripts: []string{ScriptLatin}, indexedColumn: "latin", normalized: true}
+	// romaji generated for kana titles, see KanaToRomaji
+	aniDBGeneratedRomajiTitleIndex = titleIndex{table: "anidb_titles_romaji_fts_idx", language: "x_jat", scripts: []string{ScriptLatin}, indexedColumn: "romaji", normalized: true, spaceless: true}
+	vndbGeneratedRomajiTitleIndex  = titleIndex{table: "vndb_titles_romaji_fts_idx", scripts: []string{ScriptLatin}, indexedColumn: "romaji", normalized: true, spaceless: true}
+	// acronyms of English and romaji titles, see TitleAcronyms
+	aniDBAcronymTitleIndex = titleIndex{table: "anidb_title_acronyms", scripts: []string{ScriptLatin}, acronym: true}
+	vndbAcronymTitleIndex  = titleIndex{table: "vndb_title_acronyms", scripts: []string{ScriptLatin}, acronym: true}
+)
+
+// Titles of languages without an index of their own
+// are searched in the all-language index.
+var aniDBTitleIndexes = []titleIndex{
+	aniDBJapaneseTitleIndex,
+	aniDBEnglishTitleIndex,
+	aniDBRomajiTitleIndex,
+	aniDBGeneratedRomajiTitleIndex,
+	aniDBAllTitleIndex.restrict([]string{"ja", "en", "x_jat"}, true),
+	aniDBAcronymTitleIndex,
+	userAliasIndex("anidb_titles"),
+}
+
+var vndbTitleIndexes = []titleIndex{
+	vndbJapaneseTitleIndex,
+	vndbEnglishTitleIndex,
+	vndbRomajiTitleIndex,
+	vndbGeneratedRomajiTitleIndex,
+	vndbAllTitleIndex.restrict([]string{"ja", "en"}, true),
+	vndbAcronymTitleIndex,
+	userAliasIndex("vndb_titles"),
+}
+
+// A search over the title indexes of one content table.
+type titleSearch struct {
+	// Query as given by the caller, for error messages.
+	query  string
+	routes []titleIndexRoute
+	limit  int
+	offset int
+	// Content table the indexes point into, and its live ID range.
+	table   string
+	firstID int64
+	lastID  int64
+	// See SearchOptions.Popularity and SearchOptions.PopularityFunc, and
+	// the key the latter is registered with while the search runs.
+	popularity     bool
+	popularityFunc PopularityFunc
+	popularityKey  int64
+	// Arguments of the popularity function after the score,
+	// see popularitySignalsOf.
+	popularitySignals string
+	// See searchCursorKey.
+	cursorKey string
+}
+
+// Prepares a search of the query on the indexes of the table, routing the
+// query if route is set, see buildTitleIndexRoutes. Searches restricted to
+// some languages leave out the indexes holding none of them, and filter
+// the matches of the others by the language of their title.
+func newTitleSearch(table string, query string, indexes []titleIndex, route bool, opts SearchOptions) (s titleSearch, err error) {
+	opts = opts.withDefaults()
+	s = titleSearch{
+		query:          query,
+		limit:          opts.Limit,
+		table:          table,
+		popularity:     opts.Popularity,
+		popularityFunc: opts.PopularityFunc,
+		cursorKey:      searchCursorKey(table, query, opts),
+	}
+
+	if indexes, err = withoutMissingAliasIndexes(indexes); err != nil {
+		return
+	}
+
+	if opts.Popularity {
+		if s.popularitySignals, err = popularitySignalsOf(table); err != nil {
+			return
+		}
+	}
+
+	if len(opts.Languages) > 0 {
+		var restricted []titleIndex
+
+		for _, index := range indexes {
+			if index, ok := index.restrictTo(opts.Languages); ok {
+				restricted = append(restricted, index)
+			}
+		}
+
+		indexes = restricted
+	}
+
+	if s.offset, err = opts.offset(s.cursorKey); err != nil {
+		return
+	}
+
+	if s.routes, err = buildTitleIndexRoutes(query, opts.Mode, indexes, route); err != nil {
+		return
+	}
+
+	s.firstID, s.lastID, err = getLiveRangeOfTable(table)
+
+	return
+}
+
+// Builds a UNION ALL of the live matches of every index, selecting the docid,
+// rank, offsets, matched text and column, normalized, weight and query columns.
+// Arguments are returned by matchesArgs.
+func (s titleSearch) matchesSQL() string {
+	branches := make([]string, len(s.routes))
+
+	for i, route := range s.routes {
+		if route.aliasTable != "" {
+			branches[i] = userAliasMatchesSQL(route)
+			continue
+		}
+
+		if route.acronym {
+			branches[i] = acronymMatchesSQL(route, s.table)
+			continue
+		}
+
+		docid := route.docid()
+
+		if route.contentID == "" {
+			docid = route.table + ".docid"
+		}
+
+		join, languageFilter := route.languageFilterSQL(s.table, docid)
+
+		branches[i] = fmt.Sprintf(`
+			SELECT
+				%s AS docid,
+				rank(matchinfo(%s)) AS rank,
+				offsets(%s) AS offsets,
+				%s.%s AS text,
+				'%s' AS column,
+				%t AS normalized,
+				? AS weight,
+				? AS query
+			FROM %s
+			%s
+			WHERE %s MATCH ?
+			AND %s BETWEEN ? AND ?
+			%s
+		`, docid, route.table, route.table, route.table, route.column(), route.column(), route.normalized, route.table, join, route.table, docid, languageFilter)
+	}
+
+	// no index to search, select nothing
+	if len(branches) == 0 {
+		return `
+			SELECT
+				NULL AS docid,
+				NULL AS rank,
+				NULL AS offsets,
+				NULL AS text,
+				NULL AS column,
+				NULL AS normalized,
+				NULL AS weight,
+				NULL AS query
+			WHERE FALSE
+		`
+	}
+
+	// the limit keeps SQLite from flattening a single branch into
+	// the outer query, where matchinfo can not be evaluated
+	return strings.Join(branches, "UNION ALL") + "LIMIT -1"
+}
+
+func (s titleSearch) matchesArgs() (args []any) {
+	for _, route := range s.routes {
+		if route.aliasTable != "" {
+			args = append(args, route.weight(), route.query, s.firstID, s.lastID, route.match)
+			continue
+		}
+
+		args = append(args, route.weight(), route.query, route.match, s.firstID, s.lastID)
+		args = appendStringArgs(args, route.languages)
+	}
+
+	return
+}
+
+// Expression scoring a row of matchesSQL joined to its row of the content
+// table. Arguments are returned by scoreArgs.
+func (s titleSearch) scoreSQL() string {
+	score := "matches.weight * (? * matches.rank / (matches.rank + 1) + ? * title_similarity(matches.query, matches.text))"
+
+	if s.popularity {
+		return popularitySQL(s.popularitySignals, score)
+	}
+
+	return score
+}
+
+func (s titleSearch) scoreArgs() []any {
+	if s.popularity {
+		return []any{s.popularityKey, SearchRankWeight, 1 - SearchRankWeight}
+	}
+
+	return []any{SearchRankWeight, 1 - SearchRankWeight}
+}
+
+// Largest weight of the matches of the language indexes, by which scores
+// are divided to compare them across content tables. Matches of user
+// aliases are left out, so that they still score above the others.
+func (s titleSearch) scoreScale() (scale float64) {
+	for _, route := range s.routes {
+		if route.aliasTable == "" {
+			scale = max(scale, route.weight())
+		}
+	}
+
+	if scale <= 0 {
+		return 1
+	}
+
+	return
+}
+
+// Arguments of a query selecting a page of scored matches.
+func (s titleSearch) pageArgs() []any {
+	args := append(s.scoreArgs(), s.matchesArgs()...)
+	return append(args, s.limit, s.offset)
+}
+
+// Counts the matched rows, each once however many routes matched it,
+// or the distinct values of column of the matched rows if column is
+// not empty.
+func (s titleSearch) count(column string) (total int, err error) {
+	countSQL := fmt.Sprintf("SELECT COUNT(DISTINCT docid) FROM (%s)", s.matchesSQL())
+
+	if column != "" {
+		countSQL = fmt.Sprintf(`
+			SELECT COUNT(DISTINCT %s.%s)
+			FROM (%s) AS matches
+			JOIN %s ON %s.id = matches.docid
+		`, s.table, column, s.matchesSQL(), s.table, s.table)
+	}
+
+	err = db.QueryRow(countSQL, s.matchesArgs()...).Scan(&total)
+	err = wrapMatchError(s.query, err)
+
+	return
+}
+
+// Ranks the matches of every route together, keeping the best match
+// of titles matched by several routes.
+func searchAniDBTitles(s titleSearch) (results []AniDBSearchResult, err error) {
+	// bare columns of an aggregate query with a single MAX
+	// are taken from the row holding the maximum
+	querySQL := fmt.Sprintf(`
+		SELECT
+			anidb_titles.id,
+			anidb_titles.aid,
+			anidb_titles.type,
+			anidb_titles.title,
+			anidb_titles.language,
+			MAX(%s) AS score,
+			matches.offsets,
+			matches.text,
+			matches.column,
+			matches.normalized,
+			matches.query
+		FROM (%s) AS matches
+		JOIN anidb_titles ON anidb_titles.id = matches.docid
+		GROUP BY anidb_titles.id
+		ORDER BY score DESC, anidb_titles.id
+		LIMIT ? OFFSET ?
+	`, s.scoreSQL(), s.matchesSQL())
+
+	s.popularityKey = registerPopularityFunc(s.popularityFunc)
+	defer releasePopularityFunc(s.popularityKey)
+
+	rows, err := db.Query(querySQL, s.pageArgs()...)
+
+	if err != nil {
+		err = wrapMatchError(s.query, err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var result AniDBSearchResult
+		var match titleMatch
+		err = rows.Scan(
+			&result.ID,
+			&result.AID,
+			&result.Type,
+			&result.Title,
+			&result.Language,
+			&result.Score,
+			&match.offsets,
+			&match.text,
+			&match.column,
+			&match.normalized,
+			&match.query,
+		)
+
+		if err != nil {
+			return
+		}
+
+		result.setMatch(match)
+		results = append(results, result)
+	}
+
+	err = wrapMatchError(s.query, rows.Err())
+
+	return
+}
+
+func aniDBSearchResultEntries(results []AniDBSearchResult, err error) (entries []AniDBEntry, _ error) {
+	for _, result := range results {
+		entries = append(entries, result.AniDBEntry)
+	}
+
+	return entries, err
+}
+
+func searchAniDBTitleIndexes(query string, indexes []titleIndex, route bool, opts SearchOptions) (results []AniDBSearchResult, err error) {
+	s, err := newTitleSearch("anidb_titles", query, indexes, route, opts)
+
+	if err != nil {
+		return
+	}
+
+	return searchAniDBTitles(s)
+}
+
+func SearchAniDBJapaneseTitles(query string, limit int) ([]AniDBEntry, error) {
+	return aniDBSearchResultEntries(searchAniDBTitleIndexes(query, []titleIndex{aniDBJapaneseTitleIndex}, false, SearchOptions{Limit: limit}))
+}
+
+func SearchAniDBEnglishTitles(query string, limit int) ([]AniDBEntry, error) {
+	return aniDBSearchResultEntries(searchAniDBTitleIndexes(query, []titleIndex{aniDBEnglishTitleIndex}, false, SearchOptions{Limit: limit}))
+}
+
+// Searches romaji titles, and romaji generated for kana titles
+// of anime without any.
+func SearchAniDBRomajiTitles(query string, limit int) ([]AniDBEntry, error) {
+	return aniDBSearchResultEntries(searchAniDBTitleIndexes(query, []titleIndex{aniDBRomajiTitleIndex, aniDBGeneratedRomajiTitleIndex}, false, SearchOptions{Limit: limit}))
+}
+
+// Searches Japanese, English and romaji titles, ranking all matches
+// together by their score. See SearchLanguageWeights and SearchRankWeight.
+// Kana or kanji queries only search Japanese titles, and Latin-script
+// queries English, romaji and Japanese titles, as the latter are sometimes
+// written in Latin script. Mixed queries are split accordingly.
+// User aliases are searched alongside, see UserAliasBoost, and so are
+// title acronyms for queries such as "SnK", see AcronymMatchWeight.
+func SearchAniDBTitles(query string, limit int) ([]AniDBEntry, error) {
+	return aniDBSearchResultEntries(SearchAniDBTitlesWithOptions(query, SearchOptions{Limit: limit}))
+}
+
+// Same as SearchAniDBTitles, but with the scores of the
+// matches and control over how the query is interpreted.
+func SearchAniDBTitlesWithOptions(query string, opts SearchOptions) ([]AniDBSearchResult, error) {
+	return searchAniDBTitleIndexes(query, aniDBTitleIndexes, true, opts)
+}
+
+// Same as SearchAniDBTitlesWithOptions, but also counts the matches
+// and returns the cursor of the next page.
+func SearchAniDBTitlesPage(query string, opts SearchOptions) (page AniDBSearchPage, err error) {
+	s, err := newTitleSearch("anidb_titles", query, aniDBTitleIndexes, true, opts)
+
+	if err != nil {
+		return
+	}
+
+	if page.Results, err = searchAniDBTitles(s); err != nil {
+		return
+	}
+
+	if page.Total, err = s.count(""); err != nil {
+		return
+	}
+
+	page.NextCursor = nextSearchCursor(s.offset, len(page.Results), page.Total, s.cursorKey)
+
+	return
+}
+
+// Same as SearchAniDBTitles, but returns only the best matching
+// title of each anime.
+func SearchAniDBTitlesGrouped(query string, limit int) ([]AniDBAnimeSearchResult, error) {
+	return SearchAniDBTitlesGroupedWithOptions(query, SearchOptions{Limit: limit})
+}
+
+func SearchAniDBTitlesGroupedWithOptions(query string, opts SearchOptions) (results []AniDBAnimeSearchResult, err error) {
+	s, err := newTitleSearch("anidb_titles", query, aniDBTitleIndexes, true, opts)
+
+	if err != nil {
+		return
+	}
+
+	return searchAniDBAnime(s)
+}
+
+// Same as SearchAniDBTitlesGroupedWithOptions, but also counts
+// the matching anime and returns the cursor of the next page.
+func SearchAniDBTitlesGroupedPage(query string, opts SearchOptions) (page AniDBAnimeSearchPage, err error) {
+	s, err := newTitleSearch("anidb_titles", query, aniDBTitleIndexes, true, opts)
+
+	if err != nil {
+		return
+	}
+
+	if page.Results, err = searchAniDBAnime(s); err != nil {
+		return
+	}
+
+	if page.Total, err = s.count("aid"); err != nil {
+		return
+	}
+
+	page.NextCursor = nextSearchCursor(s.offset, len(page.Results), page.Total, s.cursorKey)
+
+	return
+}
+
+// Ranks the anime of the matches by their best matching title.
+func searchAniDBAnime(s titleSearch) (results []AniDBAnimeSearchResult, err error) {
+	// bare columns of an aggregate query with a single MAX
+	// are taken from the row holding the maximum
+	querySQL := fmt.Sprintf(`
+		SELECT
+			anidb_titles.id,
+			anidb_titles.aid,
+			anidb_titles.type,
+			anidb_titles.title,
+			anidb_titles.language,
+			MAX(%s) AS score,
+			matches.offsets,
+			matches.text,
+			matches.column,
+			matches.normalized,
+			matches.query
+		FROM (%s) AS matches
+		JOIN anidb_titles ON anidb_titles.id = matches.docid
+		GROUP BY anidb_titles.aid
+		ORDER BY score DESC, CAST(anidb_titles.aid AS INTEGER)
+		LIMIT ? OFFSET ?
+	`, s.scoreSQL(), s.matchesSQL())
+
+	s.popularityKey = registerPopularityFunc(s.popularityFunc)
+	defer releasePopularityFunc(s.popularityKey)
+
+	rows, err := db.Query(querySQL, s.pageArgs()...)
+
+	if err != nil {
+		err = wrapMatchError(s.query, err)
+		return
+	}
+
+	defer rows.Close()
+
+	var aids []string
+
+	for rows.Next() {
+		var result AniDBAnimeSearchResult
+		var match titleMatch
+		err = rows.Scan(
+			&result.Match.ID,
+			&result.Match.AID,
+			&result.Match.Type,
+			&result.Match.Title,
+			&result.Match.Language,
+			&result.Match.Score,
+			&match.offsets,
+			&match.text,
+			&match.column,
+			&match.normalized,
+			&match.query,
+		)
+
+		if err != nil {
+			return
+		}
+
+		result.Match.setMatch(match)
+		result.AID = result.Match.AID
+		result.DisplayTitle = result.Match.Title
+		results = append(results, result)
+		aids = append(aids, result.AID)
+	}
+
+	if err = rows.Err(); err != nil {
+		err = wrapMatchError(s.query, err)
+		return
+	}
+
+	displayTitles, err := getAniDBDisplayTitles(aids, s.firstID, s.lastID)
+
+	if err != nil {
+		return
+	}
+
+	for i := range results {
+		if title, ok := displayTitles[results[i].AID]; ok {
+			results[i].DisplayTitle = title
+		}
+	}
+
+	return
+}
+
+// Returns the primary title of each aid.
+func getAniDBDisplayTitles(aids []string, firstID int64, lastID int64) (titles map[string]string, err error) {
+	titles = make(map[string]string)
+
+	if len(aids) == 0 {
+		return
+	}
+
+	querySQL := fmt.Sprintf(`
+		SELECT
+			anidb_titles.aid,
+			anidb_titles.title
+		FROM
+			anidb_titles
+		WHERE
+			anidb_titles.type = ?
+		AND
+			anidb_titles.aid IN (%s)
+		AND
+			anidb_titles.id BETWEEN ? AND ?
+	`, sqlPlaceholders(len(aids)))
+
+	args := appendStringArgs([]any{AniDBEntryTypePrimary}, aids)
+	rows, err := db.Query(querySQL, append(args, firstID, lastID)...)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var aid, title string
+
+		if err = rows.Scan(&aid, &title); err != nil {
+			return
+		}
+
+		titles[aid] = title
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// Same as searchAniDBTitles.
+func searchVNDBTitles(s titleSearch) (results []VNDBSearchResult, err error) {
+	querySQL := fmt.Sprintf(`
+		SELECT
+			vndb_titles.id,
+			vndb_titles.vnid,
+			vndb_titles.title,
+			vndb_titles.language,
+			vndb_titles.official,
+			vndb_titles.latin,
+			MAX(%s) AS score,
+			matches.offsets,
+			matches.text,
+			matches.column,
+			matches.normalized,
+			matches.query
+		FROM (%s) AS matches
+		JOIN vndb_titles ON vndb_titles.id = matches.docid
+		GROUP BY vndb_titles.id
+		ORDER BY score DESC, vndb_titles.id
+		LIMIT ? OFFSET ?
+	`, s.scoreSQL(), s.matchesSQL())
+
+	s.popularityKey = registerPopularityFunc(s.popularityFunc)
+	defer releasePopularityFunc(s.popularityKey)
+
+	rows, err := db.Query(querySQL, s.pageArgs()...)
+
+	if err != nil {
+		err = wrapMatchError(s.query, err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var result VNDBSearchResult
+		var match titleMatch
+		err = rows.Scan(
+			&result.ID,
+			&result.VNID,
+			&result.Title,
+			&result.Language,
+			&result.Official,
+			&result.Latin,
+			&result.Score,
+			&match.offsets,
+			&match.text,
+			&match.column,
+			&match.normalized,
+			&match.query,
+		)
+
+		if err != nil {
+			return
+		}
+
+		result.setMatch(match)
+		results = append(results, result)
+	}
+
+	err = wrapMatchError(s.query, rows.Err())
+
+	return
+}
+
+func vndbSearchResultEntries(results []VNDBSearchResult, err error) (entries []VNDBTitleEntry, _ error) {
+	for _, result := range results {
+		entries = append(entries, result.VNDBTitleEntry)
+	}
+
+	return entries, err
+}
+
+func searchVNDBTitleIndexes(query string, indexes []titleIndex, route bool, opts SearchOptions) (results []VNDBSearchResult, err error) {
+	s, err := newTitleSearch("vndb_titles", query, indexes, route, opts)
+
+	if err != nil {
+		return
+	}
+
+	return searchVNDBTitles(s)
+}
+
+func SearchVNDBJapaneseTitles(query string, limit int) ([]VNDBTitleEntry, error) {
+	return vndbSearchResultEntries(searchVNDBTitleIndexes(query, []titleIndex{vndbJapaneseTitleIndex}, false, SearchOptions{Limit: limit}))
+}
+
+func SearchVNDBEnglishTitles(query string, limit int) ([]VNDBTitleEntry, error) {
+	return vndbSearchResultEntries(searchVNDBTitleIndexes(query, []titleIndex{vndbEnglishTitleIndex}, false, SearchOptions{Limit: limit}))
+}
+
+// Searches romanizations of titles, and romaji generated for
+// kana titles without any.
+func SearchVNDBRomajiTitles(query string, limit int) ([]VNDBTitleEntry, error) {
+	return vndbSearchResultEntries(searchVNDBTitleIndexes(query, []titleIndex{vndbRomajiTitleIndex, vndbGeneratedRomajiTitleIndex}, false, SearchOptions{Limit: limit}))
+}
+
+// Searches Japanese, English and romanized titles, ranking all matches
+// together by their score, and routing the query like SearchAniDBTitles.
+func SearchVNDBTitles(query string, limit int) ([]VNDBTitleEntry, error) {
+	return vndbSearchResultEntries(SearchVNDBTitlesWithOptions(query, SearchOptions{Limit: limit}))
+}
+
+// Same as SearchVNDBTitles, but with the scores of the
+// matches and control over how the query is interpreted.
+func SearchVNDBTitlesWithOptions(query string, opts SearchOptions) ([]VNDBSearchResult, error) {
+	return searchVNDBTitleIndexes(query, vndbTitleIndexes, true, opts)
+}
+
+// Same as SearchVNDBTitlesWithOptions, but also counts the matches
+// and returns the cursor of the next page.
+func SearchVNDBTitlesPage(query string, opts SearchOptions) (page VNDBSearchPage, err error) {
+	s, err := newTitleSearch("vndb_titles", query, vndbTitleIndexes, true, opts)
+
+	if err != nil {
+		return
+	}
+
+	if page.Results, err = searchVNDBTitles(s); err != nil {
+		return
+	}
+
+	if page.Total, err = s.count(""); err != nil {
+		return
+	}
+
+	page.NextCursor = nextSearchCursor(s.offset, len(page.Results), page.Total, s.cursorKey)
+
+	return
+}
+
+// Same as SearchVNDBTitles, but returns only the best matching
+// title of each visual novel.
+func SearchVNDBTitlesGrouped(query string, limit int) ([]VNDBVisualNovelSearchResult, error) {
+	return SearchVNDBTitlesGroupedWithOptions(query, SearchOptions{Limit: limit})
+}
+
+func SearchVNDBTitlesGroupedWithOptions(query string, opts SearchOptions) (results []VNDBVisualNovelSearchResult, err error) {
+	s, err := newTitleSearch("vndb_titles", query, vndbTitleIndexes, true, opts)
+
+	if err != nil {
+		return
+	}
+
+	return searchVNDBVisualNovels(s)
+}
+
+// Same as SearchVNDBTitlesGroupedWithOptions, but also counts the
+// matching visual novels and returns the cursor of the next page.
+func SearchVNDBTitlesGroupedPage(query string, opts SearchOptions) (page VNDBVisualNovelSearchPage, err error) {
+	s, err := newTitleSearch("vndb_titles", query, vndbTitleIndexes, true, opts)
+
+	if err != nil {
+		return
+	}
+
+	if page.Results, err = searchVNDBVisualNovels(s); err != nil {
+		return
+	}
+
+	if page.Total, err = s.count("vnid"); err != nil {
+		return
+	}
+
+	page.NextCursor = nextSearchCursor(s.offset, len(page.Results), page.Total, s.cursorKey)
+
+	return
+}
+
+// Ranks the visual novels of the matches by their best matching title.
+func searchVNDBVisualNovels(s titleSearch) (results []VNDBVisualNovelSearchResult, err error) {
+	querySQL := fmt.Sprintf(`
+		SELECT
+			vndb_titles.id,
+			vndb_titles.vnid,
+			vndb_titles.title,
+			vndb_titles.language,
+			vndb_titles.official,
+			vndb_titles.latin,
+			MAX(%s) AS score,
+			matches.offsets,
+			matches.text,
+			matches.column,
+			matches.normalized,
+			matches.query
+		FROM (%s) AS matches
+		JOIN vndb_titles ON vndb_titles.id = matches.docid
+		GROUP BY vndb_titles.vnid
+		ORDER BY score DESC, CAST(SUBSTR(vndb_titles.vnid, 2) AS INTEGER)
+		LIMIT ? OFFSET ?
+	`, s.scoreSQL(), s.matchesSQL())
+
+	s.popularityKey = registerPopularityFunc(s.popularityFunc)
+	defer releasePopularityFunc(s.popularityKey)
+
+	rows, err := db.Query(querySQL, s.pageArgs()...)
+
+	if err != nil {
+		err = wrapMatchError(s.query, err)
+		return
+	}
+
+	defer rows.Close()
+
+	var vnids []string
+
+	for rows.Next() {
+		var result VNDBVisualNovelSearchResult
+		var match titleMatch
+		err = rows.Scan(
+			&result.Match.ID,
+			&result.Match.VNID,
+			&result.Match.Title,
+			&result.Match.Language,
+			&result.Match.Official,
+			&result.Match.Latin,
+			&result.Match.Score,
+			&match.offsets,
+			&match.text,
+			&match.column,
+			&match.normalized,
+			&match.query,
+		)
+
+		if err != nil {
+			return
+		}
+
+		result.Match.setMatch(match)
+		result.VNID = result.Match.VNID
+		result.DisplayTitle = result.Match.Title
+		results = append(results, result)
+		vnids = append(vnids, result.VNID)
+	}
+
+	if err = rows.Err(); err != nil {
+		err = wrapMatchError(s.query, err)
+		return
+	}
+
+	displayTitles, err := getVNDBDisplayTitles(vnids, s.firstID, s.lastID)
+
+	if err != nil {
+		return
+	}
+
+	for i := range results {
+		if title, ok := displayTitles[results[i].VNID]; ok {
+			results[i].DisplayTitle = title
+		}
+	}
+
+	return
+}
+
+// Returns the title of each vnid in its original language,
+// using the romanization when there is one.
+func getVNDBDisplayTitles(vnids []string, firstID int64, lastID int64) (titles map[string]string, err error) {
+	titles = make(map[string]string)
+
+	if len(vnids) == 0 {
+		return
+	}
+
+	querySQL := fmt.Sprintf(`
+		SELECT
+			vndb_titles.vnid,
+			COALESCE(vndb_titles.latin, vndb_titles.title)
+		FROM
+			vndb_titles
+		JOIN
+			vndb_visual_novels
+		ON
+			vndb_visual_novels.vnid = vndb_titles.vnid
+		WHERE
+			vndb_titles.language = vndb_visual_novels.original_language
+		AND
+			vndb_titles.vnid IN (%s)
+		AND
+			vndb_titles.id BETWEEN ? AND ?
+	`, sqlPlaceholders(len(vnids)))
+
+	args := appendStringArgs(nil, vnids)
+	rows, err := db.Query(querySQL, append(args, firstID, lastID)...)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var vnid, title string
+
+		if err = rows.Scan(&vnid, &title); err != nil {
+			return
+		}
+
+		titles[vnid] = title
+	}
+
+	err = rows.Err()
+
+	return
+}
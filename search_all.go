@@ -0,0 +1,680 @@
+package otame
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// One anime, visual novel or anime offline database entry found by SearchAll.
+// Source tells what ID refers to, and exactly one of Anime, VisualNovel and
+// AnimeOfflineDatabase holds the best match of the result.
+type SearchAllResult struct {
+	// One of the TitleSource* constants.
+	Source string
+	// AniDB aid, VNDB vnid or anime offline database row ID.
+	ID           string
+	DisplayTitle string
+	// URL of the poster or cover, or "" if there is none.
+	Image string
+	// Set for VNDB covers rated sexual or violent, see VNDBImageEntry.NSFW.
+	ImageNSFW bool
+	// Page of the result on its source.
+	URL string
+	// Score of the best match, divided by the largest weight of the indexes
+	// of its source so that scores of every source compare. Matches of
+	// user aliases are boosted above 1.
+	Score float64
+
+	// Set when the best match is an AniDB title.
+	Anime *AniDBAnimeSearchResult
+	// Set when the best match is a VNDB title.
+	VisualNovel *VNDBVisualNovelSearchResult
+	// Set when the best match is the title or synonym of an anime offline
+	// database entry, in which case Source is TitleSourceAniDB if the
+	// entry links to AniDB and AniDB is searched.
+	AnimeOfflineDatabase *AnimeOfflineDatabaseSearchResult
+}
+
+type SearchAllOptions struct {
+	// Maximum number of results, defaults to 20.
+	Limit  int
+	Offset int
+	// NextCursor of a previous page, see SearchOptions.Cursor.
+	Cursor string
+	// How the query is turned into a MATCH expression, see BuildMatchQuery.
+	Mode SearchMode
+	// TitleSource* constants to search, defaults to all of them.
+	Sources []string
+	// Languages of the titles to search in each source,
+	// see SearchOptions.Languages.
+	AniDBLanguages []string
+	VNDBLanguages  []string
+	// Restricts the anime offline database entries searched. Its title,
+	// sorting and paging are ignored.
+	AnimeOfflineDatabase AnimeOfflineDatabaseFilter
+	// See SearchOptions.Popularity and SearchOptions.PopularityFunc.
+	Popularity     bool
+	PopularityFunc PopularityFunc
+}
+
+func (o SearchAllOptions) withDefaults() SearchAllOptions {
+	if len(o.Sources) == 0 {
+		o.Sources = []string{TitleSourceAniDB, TitleSourceVNDB, TitleSourceAnimeOfflineDatabase}
+	}
+
+	if o.Limit <= 0 {
+		o.Limit = 20
+	}
+
+	if o.Offset < 0 {
+		o.Offset = 0
+	}
+
+	return o
+}
+
+func (o SearchAllOptions) hasSource(source string) bool {
+	for _, s := range o.Sources {
+		if s == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Options of the search of one source. Paging is done
+// once the results of every source are ranked together.
+func (o SearchAllOptions) sourceOptions(languages []string) SearchOptions {
+	return SearchOptions{
+		Mode:           o.Mode,
+		Languages:      languages,
+		Popularity:     o.Popularity,
+		PopularityFunc: o.PopularityFunc,
+	}
+}
+
+// Identifies the results a cursor of SearchAllPage pages through,
+// see searchCursorKey.
+func searchAllCursorKey(query string, opts SearchAllOptions) string {
+	filter := opts.AnimeOfflineDatabase
+	bound := func(value *int) string {
+		if value == nil {
+			return ""
+		}
+
+		return strconv.Itoa(*value)
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(
+		h,
+		"%s\x00%d\x00%q\x00%q\x00%q\x00%t\x00%t\x00%q\x00%q\x00%q\x00%s\x00%s\x00%s\x00%s\x00%q\x00%q\x00%q",
+		query, opts.Mode, opts.Sources, opts.AniDBLanguages, opts.VNDBLanguages, opts.Popularity, opts.PopularityFunc != nil,
+		filter.Types, filter.Statuses, filter.Seasons,
+		bound(filter.MinYear), bound(filter.MaxYear), bound(filter.MinEpisodes), bound(filter.MaxEpisodes),
+		filter.TagsAny, filter.TagsAll, filter.TagsNone,
+	)
+
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+type AllSearchPage struct {
+	Results []SearchAllResult
+	// Number of anime, visual novels and anime offline database
+	// entries matching over all pages, each counted once.
+	Total      int
+	NextCursor string
+}
+
+// A search of every source of SearchAll.
+type searchAll struct {
+	opts      SearchAllOptions
+	offset    int
+	cursorKey string
+	// Searches of each source, nil for sources not searched.
+	aniDB *titleSearch
+	vndb  *titleSearch
+	aodb  *titleSearch
+}
+
+func newSearchAll(query string, opts SearchAllOptions) (s searchAll, err error) {
+	opts = opts.withDefaults()
+	s = searchAll{opts: opts, cursorKey: searchAllCursorKey(query, opts)}
+
+	if s.offset, err = (SearchOptions{Offset: opts.Offset, Cursor: opts.Cursor}).offset(s.cursorKey); err != nil {
+		return
+	}
+
+	if opts.hasSource(TitleSourceAniDB) {
+		var search titleSearch
+		search, err = newTitleSearch("anidb_titles", query, aniDBTitleIndexes, true, opts.sourceOptions(opts.AniDBLanguages))
+
+		if err != nil {
+			return
+		}
+
+		s.aniDB = &search
+	}
+
+	if opts.hasSource(TitleSourceVNDB) {
+		var search titleSearch
+		search, err = newTitleSearch("vndb_titles", query, vndbTitleIndexes, true, opts.sourceOptions(opts.VNDBLanguages))
+
+		if err != nil {
+			return
+		}
+
+		s.vndb = &search
+	}
+
+	// anime offline database entries are only searched once created
+	aodbMissing, err := missingTables("anime_offline_database", "anime_offline_database_sources")
+
+	if err != nil {
+		return
+	}
+
+	if opts.hasSource(TitleSourceAnimeOfflineDatabase) && len(aodbMissing) == 0 {
+		var search titleSearch
+		search, err = newAnimeOfflineDatabaseSearch(query, opts.sourceOptions(nil))
+
+		if err != nil {
+			return
+		}
+
+		s.aodb = &search
+	}
+
+	return
+}
+
+// Searches AniDB, VNDB and anime offline database titles at once, returning
+// the best match of each anime and visual novel ranked together by their
+// normalized score. Anime offline database entries linking to AniDB are
+// merged into the anime of their aid, so that an anime is found once by any
+// of its titles and synonyms.
+func SearchAll(query string, opts SearchAllOptions) (results []SearchAllResult, err error) {
+	s, err := newSearchAll(query, opts)
+
+	if err != nil {
+		return
+	}
+
+	return s.results()
+}
+
+// Same as SearchAll, but also counts the matches and
+// returns the cursor of the next page.
+func SearchAllPage(query string, opts SearchAllOptions) (page AllSearchPage, err error) {
+	s, err := newSearchAll(query, opts)
+
+	if err != nil {
+		return
+	}
+
+	if page.Results, err = s.results(); err != nil {
+		return
+	}
+
+	if page.Total, err = s.count(); err != nil {
+		return
+	}
+
+	page.NextCursor = nextSearchCursor(s.offset, len(page.Results), page.Total, s.cursorKey)
+
+	return
+}
+
+// Ranks the results of every source together and returns the requested page.
+// Each source is asked for as many distinct results as the page ends with,
+// see fetchSearchAllSource, which is enough for the page to hold the best
+// ones whichever sources they are merged from: any result a source leaves
+// out is preceded by that many others of at least its score.
+func (s searchAll) results() (results []SearchAllResult, err error) {
+	need := s.offset + s.opts.Limit
+	byKey := make(map[string]int)
+	var sources []func(offset int, limit int) ([]SearchAllResult, error)
+
+	if s.aniDB != nil {
+		sources = append(sources, s.aniDBResults)
+	}
+
+	if s.vndb != nil {
+		sources = append(sources, s.vndbResults)
+	}
+
+	if s.aodb != nil {
+		sources = append(sources, s.aodbResults)
+	}
+
+	for _, fetch := range sources {
+		var sourceResults []SearchAllResult
+
+		if sourceResults, err = fetchSearchAllSource(need, fetch); err != nil {
+			return
+		}
+
+		for _, result := range sourceResults {
+			key := result.key()
+
+			if i, ok := byKey[key]; !ok {
+				byKey[key] = len(results)
+				results = append(results, result)
+			} else if result.Score > results[i].Score {
+				results[i] = result
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if s.offset >= len(results) {
+		return nil, nil
+	}
+
+	results = results[s.offset:min(need, len(results))]
+
+	if err = setSearchAllDisplayTitles(results); err != nil {
+		return
+	}
+
+	err = setSearchAllLinks(results)
+
+	return
+}
+
+// Fetches pages of results of one source, each twice as long as the one
+// before, until they hold need distinct results, or every match, as several
+// anime offline database entries may link to the same anime.
+func fetchSearchAllSource(need int, fetch func(offset int, limit int) ([]SearchAllResult, error)) (results []SearchAllResult, err error) {
+	keys := make(map[string]bool)
+
+	for limit := need; ; limit *= 2 {
+		var page []SearchAllResult
+
+		if page, err = fetch(len(results), limit); err != nil {
+			return
+		}
+
+		results = append(results, page...)
+
+		for _, result := range page {
+			keys[result.key()] = true
+		}
+
+		if len(page) < limit || len(keys) >= need {
+			return
+		}
+	}
+}
+
+func (r SearchAllResult) key() string {
+	return r.Source + ":" + r.ID
+}
+
+func (s searchAll) aniDBResults(offset int, limit int) (results []SearchAllResult, err error) {
+	search := *s.aniDB
+	search.offset = offset
+	search.limit = limit
+	anime, err := searchAniDBAnime(search)
+
+	if err != nil {
+		return
+	}
+
+	for i := range anime {
+		results = append(results, SearchAllResult{
+			Source:       TitleSourceAniDB,
+			ID:           anime[i].AID,
+			DisplayTitle: anime[i].DisplayTitle,
+			Score:        anime[i].Match.Score / search.scoreScale(),
+			Anime:        &anime[i],
+		})
+	}
+
+	return
+}
+
+func (s searchAll) vndbResults(offset int, limit int) (results []SearchAllResult, err error) {
+	search := *s.vndb
+	search.offset = offset
+	search.limit = limit
+	visualNovels, err := searchVNDBVisualNovels(search)
+
+	if err != nil {
+		return
+	}
+
+	for i := range visualNovels {
+		results = append(results, SearchAllResult{
+			Source:       TitleSourceVNDB,
+			ID:           visualNovels[i].VNID,
+			DisplayTitle: visualNovels[i].DisplayTitle,
+			Score:        visualNovels[i].Match.Score / search.scoreScale(),
+			VisualNovel:  &visualNovels[i],
+		})
+	}
+
+	return
+}
+
+func (s searchAll) aodbResults(offset int, limit int) (results []SearchAllResult, err error) {
+	search := *s.aodb
+	search.offset = offset
+	search.limit = limit
+	entries, err := searchAnimeOfflineDatabase(search, s.opts.AnimeOfflineDatabase)
+
+	if err != nil {
+		return
+	}
+
+	for i := range entries {
+		result := SearchAllResult{
+			Source:               TitleSourceAnimeOfflineDatabase,
+			ID:                   entries[i].ID,
+			DisplayTitle:         entries[i].Title,
+			Score:                entries[i].Score / search.scoreScale(),
+			AnimeOfflineDatabase: &entries[i],
+		}
+
+		if aid, ok := aodbEntryAID(entries[i].AnimeOfflineDatabaseEntry); ok && s.aniDB != nil {
+			result.Source = TitleSourceAniDB
+			result.ID = aid
+		}
+
+		results = append(results, result)
+	}
+
+	return
+}
+
+// Counts the distinct results of every source, after merging anime
+// offline database entries into the anime they link to.
+func (s searchAll) count() (total int, err error) {
+	var keys []string
+	var args []any
+
+	if s.aniDB != nil {
+		keys = append(keys, fmt.Sprintf(`
+			SELECT '%s:' || anidb_titles.aid AS key
+			FROM (%s) AS matches
+			JOIN anidb_titles ON anidb_titles.id = matches.docid
+		`, TitleSourceAniDB, s.aniDB.matchesSQL()))
+		args = append(args, s.aniDB.matchesArgs()...)
+	}
+
+	if s.vndb != nil {
+		keys = append(keys, fmt.Sprintf(`
+			SELECT '%s:' || vndb_titles.vnid AS key
+			FROM (%s) AS matches
+			JOIN vndb_titles ON vndb_titles.id = matches.docid
+		`, TitleSourceVNDB, s.vndb.matchesSQL()))
+		args = append(args, s.vndb.matchesArgs()...)
+	}
+
+	if s.aodb != nil {
+		filter := s.opts.AnimeOfflineDatabase
+		filter.Title = ""
+		whereClause, whereArgs, whereErr := filter.whereClause()
+
+		if whereErr != nil {
+			return 0, whereErr
+		}
+
+		key := fmt.Sprintf("'%s:' || anime_offline_database.id", TitleSourceAnimeOfflineDatabase)
+
+		if s.aniDB != nil {
+			key = fmt.Sprintf(`COALESCE((
+				SELECT '%s:' || source_id
+				FROM anime_offline_database_sources
+				WHERE anime_offline_database_id = anime_offline_database.id
+				AND source_name = '%s'
+				AND recognized
+			), %s)`, TitleSourceAniDB, ProviderAniDB, key)
+		}
+
+		keys = append(keys, fmt.Sprintf(`
+			SELECT %s AS key
+			FROM (%s) AS matches
+			JOIN anime_offline_database ON anime_offline_database.id = matches.docid
+			WHERE %s
+		`, key, s.aodb.matchesSQL(), whereClause))
+		args = append(args, s.aodb.matchesArgs()...)
+		args = append(args, whereArgs...)
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	countSQL := fmt.Sprintf("SELECT COUNT(DISTINCT key) FROM (%s)", strings.Join(keys, "UNION ALL"))
+	err = db.QueryRow(countSQL, args...).Scan(&total)
+
+	return
+}
+
+// Aid of the first AniDB source of the entry.
+func aodbEntryAID(entry AnimeOfflineDatabaseEntry) (aid string, ok bool) {
+	for _, source := range entry.Sources {
+		provider, id, err := parseAnimeProviderURL(source)
+
+		if err == nil && provider == ProviderAniDB {
+			return id, true
+		}
+	}
+
+	return
+}
+
+// Replaces the titles of anime found by their anime offline database entry
+// with their primary AniDB title, so that anime are shown under the same
+// title whichever way they are found.
+func setSearchAllDisplayTitles(results []SearchAllResult) (err error) {
+	var aids []string
+
+	for _, result := range results {
+		if result.Source == TitleSourceAniDB && result.AnimeOfflineDatabase != nil {
+			aids = append(aids, result.ID)
+		}
+	}
+
+	if len(aids) == 0 {
+		return
+	}
+
+	firstID, lastID, err := getLiveRangeOfTable("anidb_titles")
+
+	if err != nil {
+		return
+	}
+
+	titles, err := getAniDBDisplayTitles(aids, firstID, lastID)
+
+	if err != nil {
+		return
+	}
+
+	for i := range results {
+		if title, ok := titles[results[i].ID]; ok && results[i].Source == TitleSourceAniDB {
+			results[i].DisplayTitle = title
+		}
+	}
+
+	return
+}
+
+// Sets the URL and image of every result. Anime take the picture of their
+// anime offline database entry, and visual novels their VNDB cover, each
+// looked up for all results at once.
+func setSearchAllLinks(results []SearchAllResult) (err error) {
+	var aids, vnids []string
+
+	for i := range results {
+		r := &results[i]
+
+		switch r.Source {
+		case TitleSourceAniDB:
+			if r.URL, err = ProviderURL(ProviderAniDB, r.ID); err != nil {
+				return
+			}
+
+			if r.AnimeOfflineDatabase != nil {
+				r.Image = r.AnimeOfflineDatabase.Picture
+			} else {
+				aids = append(aids, r.ID)
+			}
+		case TitleSourceVNDB:
+			if r.URL, err = ProviderURL(ProviderVNDB, r.ID); err != nil {
+				return
+			}
+
+			vnids = append(vnids, r.ID)
+		case TitleSourceAnimeOfflineDatabase:
+			r.Image = r.AnimeOfflineDatabase.Picture
+
+			if len(r.AnimeOfflineDatabase.Sources) > 0 {
+				r.URL = r.AnimeOfflineDatabase.Sources[0]
+			}
+		}
+	}
+
+	pictures, err := getAnimeOfflineDatabasePicturesByAID(aids)
+
+	if err != nil {
+		return
+	}
+
+	covers, err := getVNDBCovers(vnids)
+
+	if err != nil {
+		return
+	}
+
+	for i := range results {
+		switch results[i].Source {
+		case TitleSourceAniDB:
+			if picture, ok := pictures[results[i].ID]; ok {
+				results[i].Image = picture
+			}
+		case TitleSourceVNDB:
+			if cover, ok := covers[results[i].ID]; ok {
+				results[i].Image = VNDBCDNURLFromImageID(cover.ID)
+				results[i].ImageNSFW = cover.NSFW()
+			}
+		}
+	}
+
+	return
+}
+
+// Returns the picture of the anime offline database entry of each aid.
+func getAnimeOfflineDatabasePicturesByAID(aids []string) (pictures map[string]string, err error) {
+	pictures = make(map[string]string)
+
+	if len(aids) == 0 {
+		return
+	}
+
+	missing, err := missingTables("anime_offline_database", "anime_offline_database_sources")
+
+	if err != nil || len(missing) > 0 {
+		return
+	}
+
+	querySQL := fmt.Sprintf(`
+		SELECT
+			anime_offline_database_sources.source_id,
+			anime_offline_database.picture
+		FROM
+			anime_offline_database
+		JOIN
+			anime_offline_database_sources
+		ON
+			anime_offline_database.id = anime_offline_database_sources.anime_offline_database_id
+		WHERE
+			anime_offline_database_sources.source_name = ?
+		AND
+			anime_offline_database_sources.source_id IN (%s)
+		AND
+			anime_offline_database_sources.recognized
+	`, sqlPlaceholders(len(aids)))
+
+	rows, err := db.Query(querySQL, appendStringArgs([]any{string(ProviderAniDB)}, aids)...)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var aid, picture string
+
+		if err = rows.Scan(&aid, &picture); err != nil {
+			return
+		}
+
+		pictures[aid] = picture
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// Returns the cover of each visual novel that has one. Covers
+// missing from the images table only have their ID set.
+func getVNDBCovers(vnids []string) (covers map[string]VNDBImageEntry, err error) {
+	covers = make(map[string]VNDBImageEntry)
+
+	if len(vnids) == 0 {
+		return
+	}
+
+	querySQL := fmt.Sprintf(`
+		SELECT
+			vndb_visual_novels.vnid,
+			vndb_visual_novels.image_id,
+			COALESCE(vndb_images.sexual_avg, 0),
+			COALESCE(vndb_images.violence_avg, 0)
+		FROM
+			vndb_visual_novels
+		LEFT JOIN
+			vndb_images
+		ON
+			vndb_images.id = vndb_visual_novels.image_id
+		WHERE
+			vndb_visual_novels.vnid IN (%s)
+		AND
+			vndb_visual_novels.image_id IS NOT NULL
+	`, sqlPlaceholders(len(vnids)))
+
+	rows, err := db.Query(querySQL, appendStringArgs(nil, vnids)...)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var vnid string
+		var cover VNDBImageEntry
+
+		if err = rows.Scan(&vnid, &cover.ID, &cover.SexualAvg, &cover.ViolenceAvg); err != nil {
+			return
+		}
+
+		covers[vnid] = cover
+	}
+
+	err = rows.Err()
+
+	return
+}
@@ -0,0 +1,174 @@
+package otame
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	AnimeSeasonWinter    = "WINTER"
+	AnimeSeasonSpring    = "SPRING"
+	AnimeSeasonSummer    = "SUMMER"
+	AnimeSeasonFall      = "FALL"
+	AnimeSeasonUndefined = "UNDEFINED"
+)
+
+// Returned when stepping from an UNDEFINED season, which
+// has no position in the year.
+var ErrUndefinedSeason = errors.New("season is undefined")
+
+// Seasons in calendar order, each covering three months
+// starting with winter in January.
+var animeSeasons = []string{
+	AnimeSeasonWinter,
+	AnimeSeasonSpring,
+	AnimeSeasonSummer,
+	AnimeSeasonFall,
+}
+
+func animeSeasonIndex(season string) (index int, err error) {
+	if season == AnimeSeasonUndefined {
+		err = ErrUndefinedSeason
+		return
+	}
+
+	for i, s := range animeSeasons {
+		if s == season {
+			index = i
+			return
+		}
+	}
+
+	err = fmt.Errorf("invalid season: %s", season)
+
+	return
+}
+
+// Returns the season containing t.
+func SeasonOf(t time.Time) (year int, season string) {
+	year = t.Year()
+	season = animeSeasons[(int(t.Month())-1)/3]
+
+	return
+}
+
+func CurrentSeason() (year int, season string) {
+	return SeasonOf(time.Now())
+}
+
+func NextSeason(year int, season string) (nextYear int, nextSeason string, err error) {
+	return offsetSeason(year, season, 1)
+}
+
+func PreviousSeason(year int, season string) (prevYear int, prevSeason string, err error) {
+	return offsetSeason(year, season, -1)
+}
+
+func offsetSeason(year int, season string, offset int) (newYear int, newSeason string, err error) {
+	index, err := animeSeasonIndex(season)
+
+	if err != nil {
+		return
+	}
+
+	index += offset
+	newYear = year + index/len(animeSeasons)
+	index %= len(animeSeasons)
+
+	if index < 0 {
+		index += len(animeSeasons)
+		newYear--
+	}
+
+	newSeason = animeSeasons[index]
+
+	return
+}
+
+// Returns all live entries airing in the given season, ordered by title.
+// Passing AnimeSeasonUndefined returns the entries of that year which
+// have no known season.
+func GetSeason(year int, season string) (entries []AnimeOfflineDatabaseEntry, err error) {
+	if _, err = animeSeasonIndex(season); err != nil && err != ErrUndefinedSeason {
+		return
+	}
+
+	entries, err = FilterAnimeOfflineDatabaseEntries(AnimeOfflineDatabaseFilter{
+		Seasons: []string{season},
+		MinYear: &year,
+		MaxYear: &year,
+		SortBy:  AnimeOfflineDatabaseSortByTitle,
+	})
+
+	return
+}
+
+func GetCurrentSeason() ([]AnimeOfflineDatabaseEntry, error) {
+	return GetSeason(CurrentSeason())
+}
+
+func GetNextSeason() (entries []AnimeOfflineDatabaseEntry, err error) {
+	year, season, err := NextSeason(CurrentSeason())
+
+	if err != nil {
+		return
+	}
+
+	return GetSeason(year, season)
+}
+
+func GetPreviousSeason() (entries []AnimeOfflineDatabaseEntry, err error) {
+	year, season, err := PreviousSeason(CurrentSeason())
+
+	if err != nil {
+		return
+	}
+
+	return GetSeason(year, season)
+}
+
+// Groups entries by their type, keeping the order within each group.
+func GroupAnimeOfflineDatabaseEntriesByType(entries []AnimeOfflineDatabaseEntry) map[string][]AnimeOfflineDatabaseEntry {
+	groups := make(map[string][]AnimeOfflineDatabaseEntry)
+
+	for _, entry := range entries {
+		groups[entry.Type] = append(groups[entry.Type], entry)
+	}
+
+	return groups
+}
+
+// Returns the keys of a grouping made by GroupAnimeOfflineDatabaseEntriesByType
+// in chart order: TV, movies, OVAs, ONAs, specials, then anything else.
+func SortedAnimeOfflineDatabaseTypes(groups map[string][]AnimeOfflineDatabaseEntry) (types []string) {
+	order := map[string]int{
+		AnimeOfflineDatabaseTypeTV:      0,
+		AnimeOfflineDatabaseTypeMovie:   1,
+		AnimeOfflineDatabaseTypeOVA:     2,
+		AnimeOfflineDatabaseTypeONA:     3,
+		AnimeOfflineDatabaseTypeSpecial: 4,
+	}
+
+	for t := range groups {
+		types = append(types, t)
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		oi, iKnown := order[types[i]]
+		oj, jKnown := order[types[j]]
+
+		if iKnown != jKnown {
+			return iKnown
+		}
+
+		if oi != oj {
+			return oi < oj
+		}
+
+		return types[i] < types[j]
+	})
+
+	return
+}
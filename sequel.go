@@ -0,0 +1,160 @@
+package otame
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Season and part of a franchise entry, as written in its title
+// with markers such as "Season 2", "2nd Season", "II" or "Zoku".
+type SequelMarker struct {
+	// Season number, 1 for titles without a marker, or 0 for sequels
+	// of unknown number, such as those marked "Kan".
+	Season int
+	// Part of the season, or 0 if the title has no "Part N" marker.
+	Part int
+}
+
+// Multipliers applied to the similarity of a candidate whose sequel marker
+// differs from the one of the query. Unknown weights are used when one of
+// the seasons or parts is unknown.
+var (
+	SequelMarkerMismatchWeight = 0.8
+	SequelMarkerUnknownWeight  = 0.95
+)
+
+var (
+	sequelOrdinalRegex = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)$`)
+	sequelNumberRegex  = regexp.MustCompile(`^\d{1,2}$`)
+)
+
+var sequelNumberWords = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+	"i": 1, "ii": 2, "iii": 3, "iv": 4, "v": 5,
+	"vi": 6, "vii": 7, "viii": 8, "ix": 9, "x": 10,
+}
+
+var sequelOrdinalWords = map[string]int{
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5,
+	"sixth": 6, "seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+}
+
+// Roman numerals ending a title. "V" and "X" are left out,
+// as they are more often letters than numbers.
+var sequelTrailingRomanNumerals = map[string]int{
+	"ii": 2, "iii": 3, "iv": 4, "vi": 6, "vii": 7, "viii": 8, "ix": 9,
+}
+
+// Reads a number following "Season" or "Part".
+func parseSequelNumber(word string) (n int, ok bool) {
+	if sequelNumberRegex.MatchString(word) {
+		n, _ = strconv.Atoi(word)
+		return n, true
+	}
+
+	n, ok = sequelNumberWords[word]
+
+	return
+}
+
+// Reads an ordinal preceding "Season".
+func parseSequelOrdinal(word string) (n int, ok bool) {
+	if match := sequelOrdinalRegex.FindStringSubmatch(word); match != nil {
+		n, _ = strconv.Atoi(match[1])
+		return n, true
+	}
+
+	n, ok = sequelOrdinalWords[word]
+
+	return
+}
+
+// Splits a title into its normalized text without sequel markers and the
+// season and part they mark. Recognized markers are "Season N", "Nth Season",
+// "Part N", "Zoku", and a trailing "Kan", roman numeral or number up to 12.
+// Titles made only of markers are returned whole, as if they had none.
+func ParseSequelMarker(title string) (base string, marker SequelMarker) {
+	words := strings.Fields(normalizeTitle(title))
+	remaining := make([]string, 0, len(words))
+	marker.Season = 1
+	seasonFound := false
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		next := ""
+
+		if i+1 < len(words) {
+			next = words[i+1]
+		}
+
+		if n, ok := parseSequelNumber(next); ok && word == "season" {
+			marker.Season, seasonFound = n, true
+			i++
+		} else if n, ok := parseSequelOrdinal(word); ok && next == "season" {
+			marker.Season, seasonFound = n, true
+			i++
+		} else if n, ok := parseSequelNumber(next); ok && word == "part" {
+			marker.Part = n
+			i++
+		} else if word == "zoku" {
+			marker.Season, seasonFound = 2, true
+		} else {
+			remaining = append(remaining, word)
+		}
+	}
+
+	if last := len(remaining) - 1; last > 0 && !seasonFound {
+		word := remaining[last]
+
+		if n, ok := sequelTrailingRomanNumerals[word]; ok {
+			marker.Season = n
+			remaining = remaining[:last]
+		} else if n, err := strconv.Atoi(word); err == nil && sequelNumberRegex.MatchString(word) && n >= 2 && n <= 12 {
+			marker.Season = n
+			remaining = remaining[:last]
+		} else if word == "kan" {
+			marker.Season = 0
+			remaining = remaining[:last]
+		}
+	}
+
+	if len(remaining) == 0 {
+		return strings.Join(words, " "), SequelMarker{Season: 1}
+	}
+
+	base = strings.Join(remaining, " ")
+
+	return
+}
+
+// Multiplier for a title marked title when the query is marked query.
+func sequelMarkerWeight(query SequelMarker, title SequelMarker) (weight float64) {
+	weight = 1
+
+	switch {
+	case query.Season == title.Season:
+	case query.Season == 0 && title.Season > 1, title.Season == 0 && query.Season > 1:
+		weight *= SequelMarkerUnknownWeight
+	default:
+		weight *= SequelMarkerMismatchWeight
+	}
+
+	switch {
+	case query.Part == title.Part:
+	case query.Part == 0, title.Part == 0:
+		weight *= SequelMarkerUnknownWeight
+	default:
+		weight *= SequelMarkerMismatchWeight
+	}
+
+	return
+}
+
+// Similarity of a title to a query split by ParseSequelMarker, comparing the
+// titles without their markers and weighting by how well the markers agree.
+func sequelTitleSimilarity(base string, marker SequelMarker, title string) float64 {
+	titleBase, titleMarker := ParseSequelMarker(title)
+	return titleSimilarity(base, titleBase) * sequelMarkerWeight(marker, titleMarker)
+}
@@ -0,0 +1,521 @@
+package otame
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Maximum number of suggestions returned by Suggestions.
+var SpellingSuggestionLimit = 5
+
+// Number of vocabulary terms considered as replacements of each word,
+// number of rewritten queries checked for matches, and number of unknown
+// words of a query corrected, the others being kept as written.
+var (
+	spellingCandidateLimit = 3
+	spellingCheckLimit     = 20
+	spellingWordLimit      = 4
+)
+
+type SpellingSuggestion struct {
+	// Query with every misspelled word replaced, normalized.
+	Query string
+	// Replacement of each corrected word of the query.
+	Corrections map[string]string
+	// Sum of the edit distances of the corrections.
+	Distance int
+	// Number of AniDB and VNDB titles matching the query.
+	Hits int
+}
+
+// Indexes whose vocabularies corrections are taken from. Romaji is read
+// from the indexes of the titles as written, rather than normalized.
+// The title vocabularies are kept in memory, see getSpellingVocabulary,
+// while the alias vocabulary, being small and edited at any time, is read
+// on every call.
+var (
+	spellingTitleIndexes = []titleIndex{
+		aniDBJapaneseTitleIndex,
+		aniDBEnglishTitleIndex,
+		{table: "anidb_titles_x_jat_fts_idx"},
+		aniDBAllTitleIndex,
+		vndbJapaneseTitleIndex,
+		vndbEnglishTitleIndex,
+		{table: "vndb_titles_latin_fts_idx"},
+		vndbAllTitleIndex,
+	}
+	spellingAliasIndexes = []titleIndex{
+		{table: "user_aliases_fts_idx"},
+	}
+)
+
+// Latin terms of the vocabularies of some indexes.
+type spellingVocabulary struct {
+	// Number of documents containing each term, summed over the indexes.
+	documents map[string]int
+	// Terms by their length in runes.
+	lengths map[int][]string
+	// Live ID ranges the title vocabularies were loaded for.
+	aniDBRange [2]int64
+	vndbRange  [2]int64
+}
+
+var (
+	// Title vocabulary shared by the package, and held while replacing it.
+	defaultSpellingVocabulary   *spellingVocabulary
+	defaultSpellingVocabularyMu sync.Mutex
+)
+
+// A vocabulary term close to a word of a query.
+type spellingCandidate struct {
+	term      string
+	distance  int
+	documents int
+}
+
+// Suggests corrected versions of a query, for when it matches nothing. Latin
+// words missing from the vocabulary of every title index are replaced with
+// terms within a small edit distance, and only rewritten queries matching at
+// least one title are returned, closest and most matching first. At most
+// spellingWordLimit words of the query are corrected.
+func Suggestions(query string) (suggestions []SpellingSuggestion, err error) {
+	words := strings.Fields(normalizeTitle(query))
+	candidates := make([][]spellingCandidate, len(words))
+	var checked []string
+
+	for i, word := range words {
+		candidates[i] = []spellingCandidate{{term: word}}
+
+		if isLatinWord(word) && len([]rune(word)) >= 3 {
+			checked = append(checked, word)
+		}
+	}
+
+	if len(checked) == 0 {
+		return
+	}
+
+	titles, err := getSpellingVocabulary()
+
+	if err != nil {
+		return
+	}
+
+	aliasIndexes, err := withoutMissingAliasIndexes(spellingAliasIndexes)
+
+	if err != nil {
+		return
+	}
+
+	aliases, err := loadSpellingVocabulary(aliasIndexes)
+
+	if err != nil {
+		return
+	}
+
+	vocabularies := []*spellingVocabulary{titles, aliases}
+	var unknown []string
+
+	for _, word := range checked {
+		if !hasVocabularyTerm(vocabularies, word) && len(unknown) < spellingWordLimit {
+			unknown = append(unknown, word)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return
+	}
+
+	replacements := findSpellingCandidates(vocabularies, unknown)
+
+	misspelled := false
+
+	for i, word := range words {
+		if wordReplacements, ok := replacements[word]; ok {
+			candidates[i] = wordReplacements
+			misspelled = true
+		}
+	}
+
+	if !misspelled {
+		return
+	}
+
+	combinations := newSpellingCombinations(candidates)
+
+	for i := 0; i < spellingCheckLimit && len(suggestions) < SpellingSuggestionLimit; i++ {
+		combination, ok := combinations.next()
+
+		if !ok {
+			break
+		}
+
+		suggestion := SpellingSuggestion{Corrections: make(map[string]string)}
+		terms := make([]string, len(combination))
+
+		for j, candidate := range combination {
+			terms[j] = candidate.term
+			suggestion.Distance += candidate.distance
+
+			if candidate.term != words[j] {
+				suggestion.Corrections[words[j]] = candidate.term
+			}
+		}
+
+		suggestion.Query = strings.Join(terms, " ")
+
+		if suggestion.Hits, err = countTitleMatches(suggestion.Query); err != nil {
+			return
+		}
+
+		if suggestion.Hits > 0 {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Distance != suggestions[j].Distance {
+			return suggestions[i].Distance < suggestions[j].Distance
+		}
+
+		return suggestions[i].Hits > suggestions[j].Hits
+	})
+
+	return
+}
+
+func isLatinWord(word string) bool {
+	for _, r := range word {
+		if runeScript(r) != ScriptLatin {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the title vocabulary shared by the package, reloading it
+// if the live titles have changed since it was loaded.
+func getSpellingVocabulary() (vocabulary *spellingVocabulary, err error) {
+	aniDBRange, err := getLiveRange("anidb_titles")
+
+	if err != nil {
+		return
+	}
+
+	vndbRange, err := getLiveRange("vndb_titles")
+
+	if err != nil {
+		return
+	}
+
+	defaultSpellingVocabularyMu.Lock()
+	defer defaultSpellingVocabularyMu.Unlock()
+
+	vocabulary = defaultSpellingVocabulary
+
+	if vocabulary != nil && vocabulary.aniDBRange == aniDBRange && vocabulary.vndbRange == vndbRange {
+		return
+	}
+
+	if vocabulary, err = loadSpellingVocabulary(spellingTitleIndexes); err != nil {
+		return
+	}
+
+	vocabulary.aniDBRange, vocabulary.vndbRange = aniDBRange, vndbRange
+	defaultSpellingVocabulary = vocabulary
+
+	return
+}
+
+// Loads the Latin terms of the vocabularies of the indexes.
+func loadSpellingVocabulary(indexes []titleIndex) (vocabulary *spellingVocabulary, err error) {
+	vocabulary = &spellingVocabulary{
+		documents: make(map[string]int),
+		lengths:   make(map[int][]string),
+	}
+
+	if len(indexes) == 0 {
+		return
+	}
+
+	branches := make([]string, len(indexes))
+
+	for i, index := range indexes {
+		branches[i] = fmt.Sprintf("SELECT term, documents FROM %s WHERE col = '*'", index.vocabTable())
+	}
+
+	rows, err := db.Query(strings.Join(branches, " UNION ALL "))
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var term string
+		var documents int
+
+		if err = rows.Scan(&term, &documents); err != nil {
+			return
+		}
+
+		if !isLatinWord(term) {
+			continue
+		}
+
+		if _, ok := vocabulary.documents[term]; !ok {
+			length := len([]rune(term))
+			vocabulary.lengths[length] = append(vocabulary.lengths[length], term)
+		}
+
+		vocabulary.documents[term] += documents
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// Whether the word is a term of any of the vocabularies.
+func hasVocabularyTerm(vocabularies []*spellingVocabulary, word string) bool {
+	for _, vocabulary := range vocabularies {
+		if _, ok := vocabulary.documents[word]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Largest edit distance accepted for a correction of the word.
+func maxSpellingDistance(word string) int {
+	if len([]rune(word)) <= 4 {
+		return 1
+	}
+
+	return 2
+}
+
+// Finds the vocabulary terms closest to each word, preferring terms
+// appearing in more titles, comparing each word to the terms of a length
+// within its edit distance.
+func findSpellingCandidates(vocabularies []*spellingVocabulary, words []string) (candidates map[string][]spellingCandidate) {
+	candidates = make(map[string][]spellingCandidate)
+
+	for _, word := range words {
+		wordRunes := []rune(word)
+		bound := maxSpellingDistance(word)
+		// documents of each term, summed over the vocabularies
+		documents := make(map[string]int)
+
+		for length := len(wordRunes) - bound; length <= len(wordRunes)+bound; length++ {
+			for _, vocabulary := range vocabularies {
+				for _, term := range vocabulary.lengths[length] {
+					documents[term] += vocabulary.documents[term]
+				}
+			}
+		}
+
+		for term, termDocuments := range documents {
+			if distance, ok := boundedEditDistance(wordRunes, []rune(term), bound); ok {
+				candidates[word] = append(candidates[word], spellingCandidate{term, distance, termDocuments})
+			}
+		}
+	}
+
+	for word, wordCandidates := range candidates {
+		sort.Slice(wordCandidates, func(i, j int) bool {
+			if wordCandidates[i].distance != wordCandidates[j].distance {
+				return wordCandidates[i].distance < wordCandidates[j].distance
+			}
+
+			if wordCandidates[i].documents != wordCandidates[j].documents {
+				return wordCandidates[i].documents > wordCandidates[j].documents
+			}
+
+			return wordCandidates[i].term < wordCandidates[j].term
+		})
+
+		candidates[word] = wordCandidates[:min(len(wordCandidates), spellingCandidateLimit)]
+	}
+
+	return
+}
+
+// Levenshtein distance of a and b, if it is at most bound.
+func boundedEditDistance(a []rune, b []rune, bound int) (distance int, ok bool) {
+	if abs(len(a)-len(b)) > bound {
+		return
+	}
+
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := current[0]
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			rowMin = min(rowMin, current[j])
+		}
+
+		if rowMin > bound {
+			return
+		}
+
+		previous, current = current, previous
+	}
+
+	distance = previous[len(b)]
+	ok = distance <= bound
+
+	return
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+// Enumerates the combinations of one candidate per word lazily, ordered by
+// total distance, then by total documents. Candidates of each word must be
+// in that order, so that the combinations following a combination, made by
+// moving one word to its next candidate, never come before it. A combination
+// is only followed by moving the word it last moved or a later one, so that
+// each is reached once.
+type spellingCombinations struct {
+	candidates [][]spellingCandidate
+	queue      spellingCombinationQueue
+}
+
+// A combination as the candidate index of each word.
+type spellingCombination struct {
+	choices   []int
+	distance  int
+	documents int
+	// First word the combinations following this one may move.
+	pivot int
+}
+
+type spellingCombinationQueue []spellingCombination
+
+func (q spellingCombinationQueue) Len() int      { return len(q) }
+func (q spellingCombinationQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q spellingCombinationQueue) Less(i, j int) bool {
+	if q[i].distance != q[j].distance {
+		return q[i].distance < q[j].distance
+	}
+
+	return q[i].documents > q[j].documents
+}
+
+func (q *spellingCombinationQueue) Push(x any) { *q = append(*q, x.(spellingCombination)) }
+
+func (q *spellingCombinationQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
+
+func newSpellingCombinations(candidates [][]spellingCandidate) *spellingCombinations {
+	c := &spellingCombinations{candidates: candidates}
+	first := spellingCombination{choices: make([]int, len(candidates))}
+
+	for _, wordCandidates := range candidates {
+		if len(wordCandidates) == 0 {
+			return c
+		}
+
+		first.distance += wordCandidates[0].distance
+		first.documents += wordCandidates[0].documents
+	}
+
+	c.queue = spellingCombinationQueue{first}
+
+	return c
+}
+
+// Returns the next best combination, or false once all have been returned.
+func (c *spellingCombinations) next() (combination []spellingCandidate, ok bool) {
+	if c.queue.Len() == 0 {
+		return
+	}
+
+	best := heap.Pop(&c.queue).(spellingCombination)
+
+	for word := best.pivot; word < len(best.choices); word++ {
+		choice := best.choices[word]
+
+		if choice+1 >= len(c.candidates[word]) {
+			continue
+		}
+
+		current, following := c.candidates[word][choice], c.candidates[word][choice+1]
+		choices := append([]int{}, best.choices...)
+		choices[word]++
+
+		heap.Push(&c.queue, spellingCombination{
+			choices:   choices,
+			distance:  best.distance - current.distance + following.distance,
+			documents: best.documents - current.documents + following.documents,
+			pivot:     word,
+		})
+	}
+
+	combination = make([]spellingCandidate, len(best.choices))
+
+	for word, choice := range best.choices {
+		combination[word] = c.candidates[word][choice]
+	}
+
+	return combination, true
+}
+
+// Counts the AniDB and VNDB titles matching every word of the query.
+func countTitleMatches(query string) (hits int, err error) {
+	for _, source := range []struct {
+		table   string
+		indexes []titleIndex
+	}{
+		{"anidb_titles", aniDBTitleIndexes},
+		{"vndb_titles", vndbTitleIndexes},
+	} {
+		var s titleSearch
+		s, err = newTitleSearch(source.table, query, source.indexes, true, SearchOptions{})
+
+		if err != nil {
+			return
+		}
+
+		var count int
+
+		if count, err = s.count(""); err != nil {
+			return
+		}
+
+		hits += count
+	}
+
+	return
+}
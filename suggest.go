@@ -0,0 +1,522 @@
+package otame
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+type Suggestion struct {
+	// One of the TitleSource* constants.
+	Source string
+	// AniDB aid or VNDB vnid.
+	ID string
+	// Title of the anime or visual novel matching the prefix.
+	Title string
+	// Popularity of the anime or visual novel from 0 to 1,
+	// see PopularitySignals.Popularity.
+	Popularity float64
+}
+
+// A title of an anime or visual novel.
+type suggesterTitle struct {
+	title string
+	group int
+	// Lower ranks are preferred when several titles of the same
+	// anime or visual novel match, see suggesterTitleRank.
+	rank int
+}
+
+// A searchable suffix of a normalized title, starting at a word.
+type suggesterKey struct {
+	key   string
+	title int
+	// Whether the key is the whole title.
+	start bool
+}
+
+// Best matching title of an anime or visual novel.
+type suggesterMatch struct {
+	title int
+	start bool
+}
+
+const (
+	// Prefixes matching more keys have their suggestions ranked when
+	// loading, rather than by scanning their keys on every call.
+	suggesterScanLimit = 1000
+	// Number of suggestions kept for each such prefix. Suggest scans
+	// the keys of the prefix when asked for more.
+	suggesterPrecomputedSuggestions = 50
+)
+
+// In-memory prefix index over the live AniDB and VNDB titles.
+// Titles match a prefix of their normalized text or of any of its words.
+// A Suggester is safe for concurrent use once loaded.
+type Suggester struct {
+	groups []Suggestion
+	titles []suggesterTitle
+	keys   []suggesterKey
+	// Ranked suggestions of the prefixes matching too many keys to scan.
+	precomputed map[string][]suggesterMatch
+	// Live ID ranges the titles were loaded from.
+	aniDBRange [2]int64
+	vndbRange  [2]int64
+	// Live ID range of the anime offline database the popularity of anime
+	// was loaded from, zero if it has no table.
+	aodbRange [2]int64
+}
+
+// Ranks AniDB title types, and VNDB titles loaded
+// with a type of "official" or "unofficial".
+func suggesterTitleRank(titleType string) int {
+	switch titleType {
+	case AniDBEntryTypePrimary:
+		return 0
+	case AniDBEntryTypeOfficial:
+		return 1
+	case AniDBEntryTypeSynonym, "unofficial":
+		return 2
+	}
+
+	return 3
+}
+
+// Loads every live AniDB and VNDB title into a new Suggester.
+func LoadSuggester() (s *Suggester, err error) {
+	s = &Suggester{}
+
+	if s.aniDBRange, err = getLiveRange("anidb_titles"); err != nil {
+		return
+	}
+
+	if s.vndbRange, err = getLiveRange("vndb_titles"); err != nil {
+		return
+	}
+
+	if s.aodbRange, err = getAnimeOfflineDatabaseLiveRange(); err != nil {
+		return
+	}
+
+	err = s.loadTitles(TitleSourceAniDB, `
+		SELECT aid, title, type
+		FROM anidb_titles
+		WHERE id BETWEEN ? AND ?
+		ORDER BY id
+	`, s.aniDBRange)
+
+	if err != nil {
+		return
+	}
+
+	// romanizations are suggested as titles of their own
+	err = s.loadTitles(TitleSourceVNDB, `
+		SELECT vnid, title, CASE WHEN official THEN 'official' ELSE 'unofficial' END
+		FROM vndb_titles
+		WHERE id BETWEEN ? AND ?
+		UNION ALL
+		SELECT vnid, latin, CASE WHEN official THEN 'official' ELSE 'unofficial' END
+		FROM vndb_titles
+		WHERE id BETWEEN ? AND ?
+		AND latin IS NOT NULL
+	`, s.vndbRange, s.vndbRange)
+
+	if err != nil {
+		return
+	}
+
+	if err = s.loadPopularity(); err != nil {
+		return
+	}
+
+	s.index()
+
+	return
+}
+
+// Sorts the keys and ranks the suggestions of the prefixes matching
+// more than suggesterScanLimit of them. Popularity must be loaded first.
+func (s *Suggester) index() {
+	sort.Slice(s.keys, func(i, j int) bool {
+		return s.keys[i].key < s.keys[j].key
+	})
+
+	s.precomputed = make(map[string][]suggesterMatch)
+	s.precompute("", s.keys)
+}
+
+// Ranks the suggestions of the prefix, whose keys are given, then of each
+// prefix one character longer, until they match few enough keys to scan.
+func (s *Suggester) precompute(prefix string, keys []suggesterKey) {
+	if len(keys) <= suggesterScanLimit {
+		return
+	}
+
+	if prefix != "" {
+		s.precomputed[prefix] = s.rank(keys, suggesterPrecomputedSuggestions)
+	}
+
+	// keys are sorted, so those sharing the next character are contiguous
+	for len(keys) > 0 {
+		if len(keys[0].key) == len(prefix) {
+			keys = keys[1:]
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(keys[0].key[len(prefix):])
+		next := keys[0].key[:len(prefix)+size]
+		end := sort.Search(len(keys), func(i int) bool {
+			return !strings.HasPrefix(keys[i].key, next)
+		})
+
+		s.precompute(next, keys[:end])
+		keys = keys[end:]
+	}
+}
+
+func getLiveRange(table string) (liveRange [2]int64, err error) {
+	liveRange[0], liveRange[1], err = getLiveRangeOfTable(table)
+	return
+}
+
+func getAnimeOfflineDatabaseLiveRange() (liveRange [2]int64, err error) {
+	missing, err := missingTables("anime_offline_database")
+
+	if err != nil || len(missing) > 0 {
+		return
+	}
+
+	return getLiveRange("anime_offline_database")
+}
+
+// Adds the ID, title and title type rows of the query to the suggester.
+func (s *Suggester) loadTitles(source string, query string, ranges ...[2]int64) (err error) {
+	var args []any
+
+	for _, r := range ranges {
+		args = append(args, r[0], r[1])
+	}
+
+	rows, err := db.Query(query, args...)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	groups := make(map[string]int)
+
+	for rows.Next() {
+		var id, title, titleType string
+
+		if err = rows.Scan(&id, &title, &titleType); err != nil {
+			return
+		}
+
+		group, ok := groups[id]
+
+		if !ok {
+			group = len(s.groups)
+			groups[id] = group
+			s.groups = append(s.groups, Suggestion{Source: source, ID: id})
+		}
+
+		s.addTitle(title, group, suggesterTitleRank(titleType))
+	}
+
+	return rows.Err()
+}
+
+// Sets the popularity of the loaded anime from their anime offline database
+// entry, and of the visual novels from their VNDB votes and rating. Those
+// without signals, or with tables missing from the database, stay at 0.
+func (s *Suggester) loadPopularity() (err error) {
+	signals := make(map[string]PopularitySignals)
+
+	missing, err := missingTables("anime_offline_database_sources", "anime_offline_database_scores")
+
+	if err != nil {
+		return
+	}
+
+	if len(missing) == 0 {
+		err = s.loadPopularitySignals(signals, fmt.Sprintf(`
+			SELECT
+				'%s',
+				anidb_sources.source_id,
+				0,
+				0.0,
+				COUNT(*),
+				COALESCE(MAX(anime_offline_database_scores.arithmetic_geometric_mean), 0.0)
+			FROM anime_offline_database_sources AS anidb_sources
+			JOIN anime_offline_database_sources
+			ON anime_offline_database_sources.anime_offline_database_id = anidb_sources.anime_offline_database_id
+			LEFT JOIN anime_offline_database_scores
+			ON anime_offline_database_scores.anime_offline_database_id = anidb_sources.anime_offline_database_id
+			WHERE anidb_sources.source_name = '%s'
+			AND anidb_sources.recognized
+			GROUP BY anidb_sources.anime_offline_database_id
+		`, TitleSourceAniDB, ProviderAniDB))
+
+		if err != nil {
+			return
+		}
+	}
+
+	if missing, err = missingTables("vndb_visual_novel_stats"); err != nil {
+		return
+	}
+
+	if len(missing) == 0 {
+		err = s.loadPopularitySignals(signals, fmt.Sprintf(`
+			SELECT '%s', vnid, vote_count, COALESCE(rating / 100.0, 0.0), 0, 0.0
+			FROM vndb_visual_novel_stats
+		`, TitleSourceVNDB))
+
+		if err != nil {
+			return
+		}
+	}
+
+	for i, group := range s.groups {
+		if groupSignals, ok := signals[group.Source+":"+group.ID]; ok {
+			s.groups[i].Popularity = groupSignals.Popularity()
+		}
+	}
+
+	return
+}
+
+// Adds the signals of the source, ID, votes, rating, sources and score rows
+// of the query to signals, keeping the most popular of an ID found twice.
+func (s *Suggester) loadPopularitySignals(signals map[string]PopularitySignals, query string) (err error) {
+	rows, err := db.Query(query)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var row PopularitySignals
+
+		if err = rows.Scan(&row.Source, &id, &row.Votes, &row.Rating, &row.Sources, &row.Score); err != nil {
+			return
+		}
+
+		key := row.Source + ":" + id
+
+		if current, ok := signals[key]; !ok || row.Popularity() > current.Popularity() {
+			signals[key] = row
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Suggester) addTitle(title string, group int, rank int) {
+	normalized := normalizeTitle(title)
+
+	if normalized == "" {
+		return
+	}
+
+	i := len(s.titles)
+	s.titles = append(s.titles, suggesterTitle{title, group, rank})
+	s.keys = append(s.keys, suggesterKey{normalized, i, true})
+
+	for j := 1; j < len(normalized); j++ {
+		if normalized[j-1] == ' ' {
+			s.keys = append(s.keys, suggesterKey{normalized[j:], i, false})
+		}
+	}
+}
+
+// Returns up to n anime and visual novels with a title matching the prefix,
+// each with its best matching title. Titles starting with the prefix come
+// first, then those with a word starting with it, each ordered by popularity.
+func (s *Suggester) Suggest(prefix string, n int) (suggestions []Suggestion) {
+	prefix = normalizeTitle(prefix)
+
+	if prefix == "" || n <= 0 {
+		return
+	}
+
+	matches, ok := s.precomputed[prefix]
+
+	// fewer than kept means every match was kept
+	if !ok || (n > len(matches) && len(matches) == suggesterPrecomputedSuggestions) {
+		first := sort.Search(len(s.keys), func(i int) bool {
+			return s.keys[i].key >= prefix
+		})
+		last := first + sort.Search(len(s.keys)-first, func(i int) bool {
+			return !strings.HasPrefix(s.keys[first+i].key, prefix)
+		})
+
+		matches = s.rank(s.keys[first:last], n)
+	}
+
+	for _, m := range matches[:min(n, len(matches))] {
+		suggestion := s.groups[s.titles[m.title].group]
+		suggestion.Title = s.titles[m.title].title
+		suggestions = append(suggestions, suggestion)
+	}
+
+	return
+}
+
+// Returns the best matching title of up to n anime and visual novels
+// with any of the keys, in the order they are suggested.
+func (s *Suggester) rank(keys []suggesterKey, n int) (matches []suggesterMatch) {
+	better := func(a suggesterMatch, b suggesterMatch) bool {
+		if a.start != b.start {
+			return a.start
+		}
+
+		ta, tb := s.titles[a.title], s.titles[b.title]
+
+		if ta.rank != tb.rank {
+			return ta.rank < tb.rank
+		}
+
+		return len(ta.title) < len(tb.title)
+	}
+
+	best := make(map[int]suggesterMatch)
+
+	for _, key := range keys {
+		m := suggesterMatch{key.title, key.start}
+		group := s.titles[key.title].group
+
+		if current, ok := best[group]; !ok || better(m, current) {
+			best[group] = m
+		}
+	}
+
+	groups := make([]int, 0, len(best))
+
+	for group := range best {
+		groups = append(groups, group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := best[groups[i]], best[groups[j]]
+
+		if a.start != b.start {
+			return a.start
+		}
+
+		if pa, pb := s.groups[groups[i]].Popularity, s.groups[groups[j]].Popularity; pa != pb {
+			return pa > pb
+		}
+
+		return groups[i] < groups[j]
+	})
+
+	for _, group := range groups[:min(n, len(groups))] {
+		matches = append(matches, best[group])
+	}
+
+	return
+}
+
+// Whether the titles and anime offline database entries
+// the suggester was loaded from are still live.
+func (s *Suggester) isCurrent() (current bool, err error) {
+	aniDBRange, err := getLiveRange("anidb_titles")
+
+	if err != nil {
+		return
+	}
+
+	vndbRange, err := getLiveRange("vndb_titles")
+
+	if err != nil {
+		return
+	}
+
+	aodbRange, err := getAnimeOfflineDatabaseLiveRange()
+	current = aniDBRange == s.aniDBRange && vndbRange == s.vndbRange && aodbRange == s.aodbRange
+
+	return
+}
+
+// How long the Suggester shared by the package is used before checking
+// whether the titles have been updated. Checks and reloads happen in the
+// background, with the previous Suggester still in use meanwhile.
+var SuggesterRefreshInterval = time.Minute
+
+var (
+	defaultSuggester atomic.Pointer[Suggester]
+	// Held while loading the first Suggester.
+	defaultSuggesterMu sync.Mutex
+	// Unix time in nanoseconds of the last check, and whether one is running.
+	defaultSuggesterCheckedAt  atomic.Int64
+	defaultSuggesterRefreshing atomic.Bool
+)
+
+// Suggests titles using a Suggester shared by the package, which is loaded
+// on first use and reloaded within SuggesterRefreshInterval of an update.
+func Suggest(prefix string, n int) (suggestions []Suggestion, err error) {
+	s, err := getDefaultSuggester()
+
+	if err != nil {
+		return
+	}
+
+	suggestions = s.Suggest(prefix, n)
+
+	return
+}
+
+func getDefaultSuggester() (s *Suggester, err error) {
+	if s = defaultSuggester.Load(); s != nil {
+		checkedAt := time.Unix(0, defaultSuggesterCheckedAt.Load())
+
+		if time.Since(checkedAt) >= SuggesterRefreshInterval && defaultSuggesterRefreshing.CompareAndSwap(false, true) {
+			go refreshDefaultSuggester()
+		}
+
+		return
+	}
+
+	defaultSuggesterMu.Lock()
+	defer defaultSuggesterMu.Unlock()
+
+	if s = defaultSuggester.Load(); s != nil {
+		return
+	}
+
+	if s, err = LoadSuggester(); err != nil {
+		return
+	}
+
+	defaultSuggesterCheckedAt.Store(time.Now().UnixNano())
+	defaultSuggester.Store(s)
+
+	return
+}
+
+// Reloads the shared Suggester if the titles have been updated. Failed
+// checks and loads keep the current one until the next check.
+func refreshDefaultSuggester() {
+	defer defaultSuggesterRefreshing.Store(false)
+	defer defaultSuggesterCheckedAt.Store(time.Now().UnixNano())
+
+	current, err := defaultSuggester.Load().isCurrent()
+
+	if err != nil || current {
+		return
+	}
+
+	if s, err := LoadSuggester(); err == nil {
+		defaultSuggester.Store(s)
+	}
+}
@@ -0,0 +1,71 @@
+package otame
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// Builds a suggester of generated titles sharing a small vocabulary,
+// so that short prefixes match far more keys than suggesterScanLimit.
+func newTestSuggester(titles int) (s *Suggester) {
+	s = &Suggester{}
+	random := rand.New(rand.NewSource(1))
+	words := []string{
+		"attack", "titan", "sword", "art", "online", "kimi", "no", "na",
+		"wa", "shingeki", "kyojin", "monogatari", "season", "the", "movie",
+		"girls", "love", "live", "school", "idol", "project", "hero",
+	}
+
+	for i := 0; i < titles; i++ {
+		title := words[random.Intn(len(words))]
+
+		for j := random.Intn(4); j >= 0; j-- {
+			title += " " + words[random.Intn(len(words))]
+		}
+
+		s.groups = append(s.groups, Suggestion{
+			Source:     TitleSourceAniDB,
+			ID:         fmt.Sprint(i),
+			Popularity: random.Float64(),
+		})
+		s.addTitle(title, i, random.Intn(4))
+	}
+
+	s.index()
+
+	return
+}
+
+func TestSuggestPrecomputed(t *testing.T) {
+	s := newTestSuggester(20000)
+
+	if len(s.precomputed) == 0 {
+		t.Fatal("no prefix was precomputed")
+	}
+
+	scanned := &Suggester{groups: s.groups, titles: s.titles, keys: s.keys}
+
+	for _, prefix := range []string{"a", "at", "attack", "s", "sword art", "no na", "z"} {
+		for _, n := range []int{1, 10, suggesterPrecomputedSuggestions, 200} {
+			got, want := s.Suggest(prefix, n), scanned.Suggest(prefix, n)
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Suggest(%q, %d) = %v, want %v", prefix, n, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkSuggest(b *testing.B) {
+	s := newTestSuggester(100000)
+
+	for _, prefix := range []string{"s", "sh", "shingeki no", "monogatari season"} {
+		b.Run(prefix, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.Suggest(prefix, 10)
+			}
+		})
+	}
+}
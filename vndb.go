@@ -18,10 +18,25 @@ type VNDBTitleEntry struct {
 	Latin    *string
 }
 
+// Links a release to one of the visual novels it contains.
+type VNDBReleaseVisualNovelEntry struct {
+	ReleaseID string
+	VNID      string
+}
+
+// Links a character to one of the visual novels it appears in.
+type VNDBCharacterVisualNovelEntry struct {
+	CharacterID string
+	VNID        string
+}
+
 type VNDBVisualNovelEntry struct {
 	ID               string
 	OriginalLanguage string
 	ImageID          *string
+	VoteCount        int
+	// Bayesian rating times 100, from 100 to 1000, or nil without votes.
+	Rating *int
 }
 
 func VNDBCDNURLFromImageID(imgID string) string {
@@ -113,8 +128,9 @@ func NewVNDBVisualNovelEntryDecoder(r io.Reader) *genericLineDecoder[VNDBVisualN
 	return &genericLineDecoder[VNDBVisualNovelEntry]{
 		scanner:       bufio.NewScanner(r),
 		separatorChar: "\t",
-		// actually more than 4 columns, but we only care about the first 3
-		nCols: 4,
+		// id	olang	image	l_wikidata	c_votecount	c_rating	...
+		// actually more than 7 columns, but we only care about the first 6
+		nCols: 7,
 		unmarshal: func(line []string) (entry VNDBVisualNovelEntry, err error) {
 			entry.ID = line[0]
 			entry.OriginalLanguage = line[1]
@@ -123,6 +139,52 @@ func NewVNDBVisualNovelEntryDecoder(r io.Reader) *genericLineDecoder[VNDBVisualN
 				entry.ImageID = &line[2]
 			}
 
+			if entry.VoteCount, err = strconv.Atoi(line[4]); err != nil {
+				err = fmt.Errorf("invalid vote count: %w", err)
+				return
+			}
+
+			if line[5] != "\\N" {
+				var rating int
+
+				if rating, err = strconv.Atoi(line[5]); err != nil {
+					err = fmt.Errorf("invalid rating: %w", err)
+					return
+				}
+
+				entry.Rating = &rating
+			}
+
+			return
+		},
+	}
+}
+
+func NewVNDBReleaseVisualNovelEntryDecoder(r io.Reader) *genericLineDecoder[VNDBReleaseVisualNovelEntry] {
+	// id	vid	rtype
+	return &genericLineDecoder[VNDBReleaseVisualNovelEntry]{
+		scanner:       bufio.NewScanner(r),
+		separatorChar: "\t",
+		nCols:         3,
+		unmarshal: func(line []string) (entry VNDBReleaseVisualNovelEntry, err error) {
+			entry.ReleaseID = line[0]
+			entry.VNID = line[1]
+
+			return
+		},
+	}
+}
+
+func NewVNDBCharacterVisualNovelEntryDecoder(r io.Reader) *genericLineDecoder[VNDBCharacterVisualNovelEntry] {
+	return &genericLineDecoder[VNDBCharacterVisualNovelEntry]{
+		scanner:       bufio.NewScanner(r),
+		separatorChar: "\t",
+		// actually more than 3 columns, but we only care about the first 2
+		nCols: 3,
+		unmarshal: func(line []string) (entry VNDBCharacterVisualNovelEntry, err error) {
+			entry.CharacterID = line[0]
+			entry.VNID = line[1]
+
 			return
 		},
 	}